@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -19,6 +20,8 @@ import (
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/internal/ui"
 	"github.com/sokinpui/coder/internal/utils"
+	"github.com/sokinpui/coder/pkg/itf"
+	"github.com/sokinpui/coder/pkg/pcat"
 
 	"github.com/spf13/cobra"
 )
@@ -33,7 +36,9 @@ var (
 	globalConfig      bool
 	execMode          bool
 	applyFlag         bool
+	jsonFlag          bool
 	completionShell   string
+	nulFlag           bool
 )
 
 func main() {
@@ -66,8 +71,21 @@ func main() {
 	rootCmd.Flags().BoolVar(&configFlag, "config", false, "Edit configuration file")
 	rootCmd.Flags().BoolVarP(&globalConfig, "global", "g", false, "Use with --config to edit global configuration")
 	rootCmd.Flags().BoolVarP(&applyFlag, "apply", "a", false, "Apply code changes using itf format from args or stdin")
+	rootCmd.Flags().BoolVar(&jsonFlag, "json", false, "Use with --apply to print the result as JSON")
+	rootCmd.Flags().BoolVarP(&nulFlag, "null", "0", false, "Read a NUL-separated file list from stdin, as printed by sf -0")
 	rootCmd.Flags().StringVar(&completionShell, "completion", "", "Generate autocompletion script (bash, zsh, fish, powershell)")
 
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "commit",
+		Short: "Generate a commit message for the staged changes and commit",
+		Long: `Generate a commit message for the staged changes with the title model, open it in $EDITOR and commit.
+When nothing is staged, the files changed by the last itf apply are staged first.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runCommit()
+		},
+	})
+
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 
 	if err := rootCmd.Execute(); err != nil {
@@ -224,6 +242,9 @@ func printContext(mode string, args []string) {
 	}
 
 	fullPrompt := sess.BuildPrompt(messages)
+	if report := sess.RedactionReport(); report != "" {
+		fmt.Fprintln(os.Stderr, report)
+	}
 	for _, msg := range fullPrompt {
 		fmt.Printf("[%s]\n%s\n\n", msg.Type, msg.Content)
 	}
@@ -277,6 +298,9 @@ func runSingleShot(args []string) {
 	}
 
 	promptMsgs := sess.BuildPrompt(messages)
+	if report := sess.RedactionReport(); report != "" {
+		fmt.Fprintln(os.Stderr, report)
+	}
 	streamChan := make(chan types.StreamChunk, 100)
 	ctx := context.Background()
 
@@ -332,13 +356,47 @@ func applyChanges(args []string) {
 		os.Exit(1)
 	}
 
-	res := commands.ExecuteItf(content, "")
-	fmt.Println(res.Summary)
+	cfg, _ := config.Load()
+	res := commands.ExecuteItf(content, "", commands.NewItfConfig(cfg))
+	if jsonFlag {
+		data, _ := json.MarshalIndent(res.Result, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Println(res.Summary)
+	}
 	if !res.Success {
 		os.Exit(1)
 	}
 }
 
+func runCommit() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	paths, _ := itf.LastAppliedPaths()
+	messageFile, staged, err := commands.PrepareCommit(cfg, paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.Remove(messageFile)
+
+	cmd := utils.CommitCommand(messageFile)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(messageFile)
+		if err := utils.UnstagePaths(staged); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unstaging %s: %v\n", strings.Join(staged, ", "), err)
+		}
+		os.Exit(1)
+	}
+}
+
 func collectFiles(args []string) []string {
 	var files []string
 
@@ -353,19 +411,33 @@ func collectFiles(args []string) []string {
 		files = append(files, matches...)
 	}
 
-	// Handle piped input if it looks like a file list
-	if piped := readPipedInput(); piped != "" && isFileList(piped) {
-		lines := strings.SplitSeq(strings.TrimSpace(piped), "\n")
-		for line := range lines {
-			trimmed := strings.TrimSpace(line)
-			if trimmed == "" {
+	// A piped stdin is a file list, e.g. from sf or find.
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+		piped, err := pcat.ReadFileList(os.Stdin, nulFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: reading file list from stdin: %v\n", err)
+		}
+		// Piped text that is not a file list resolves to no file at all, and
+		// is not worth a warning per line.
+		var skipped []string
+		resolved := false
+		for _, path := range piped {
+			// Avoid duplicates if already added via positional args
+			if slices.Contains(files, path) {
+				resolved = true
 				continue
 			}
-			// Avoid duplicates if already added via positional args
-			if slices.Contains(files, trimmed) {
+			if _, err := os.Stat(pcat.ParseSelector(path).Path); err != nil {
+				skipped = append(skipped, fmt.Sprintf("Warning: skipping %s from stdin: %v", path, err))
 				continue
 			}
-			files = append(files, trimmed)
+			resolved = true
+			files = append(files, path)
+		}
+		if resolved || nulFlag {
+			for _, warning := range skipped {
+				fmt.Fprintln(os.Stderr, warning)
+			}
 		}
 	}
 	return files
@@ -388,21 +460,3 @@ func readPipedInput() string {
 
 	return string(bytes)
 }
-
-func isFileList(input string) bool {
-	trimmed := strings.TrimSpace(input)
-	if trimmed == "" {
-		return false
-	}
-	lines := strings.SplitSeq(trimmed, "\n")
-	for line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if _, err := os.Stat(line); err != nil {
-			return false
-		}
-	}
-	return true
-}
@@ -1,12 +1,15 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/sokinpui/coder/internal/token"
 	"github.com/sokinpui/coder/pkg/pcat"
+	"github.com/sokinpui/coder/pkg/sf"
 	"github.com/sokinpui/coder/pkg/version"
 	"github.com/spf13/cobra"
 )
@@ -14,7 +17,13 @@ import (
 var (
 	extensions, excludePatterns, paths             []string
 	withLineNumbers, hidden, listOnly, toClipboard bool
+	outline                                        bool
 	completionShell                                string
+	maxTokens                                      int
+	format                                         string
+	gitSel                                         sf.GitSelection
+	withDiff                                       bool
+	fromStdin, nul                                 bool
 )
 
 var rootCmd = &cobra.Command{
@@ -22,7 +31,10 @@ var rootCmd = &cobra.Command{
 	Version: version.Get(),
 	Short:   "Concatenate and print files from specified paths (files and directories).",
 	Long: `Concatenate and print files from specified paths (files and directories).
-If no paths are provided, paths are read from stdin.`,
+If no paths are provided, or with --stdin, paths are read from stdin, one per
+line or, with -0, separated by NUL bytes:
+
+  sf -t file -E vendor -0 | pcat --stdin -0 -c`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if completionShell != "" {
 			return handleCompletion(cmd)
@@ -48,22 +60,21 @@ func handleCompletion(cmd *cobra.Command) error {
 }
 
 func getPaths(args []string) ([]string, error) {
-	if len(args) > 0 {
+	if len(args) > 0 && !fromStdin {
 		return args, nil
 	}
-	stat, _ := os.Stdin.Stat()
-	if (stat.Mode() & os.ModeCharDevice) == 0 {
-		paths := make([]string, 0)
-		scanner := bufio.NewScanner(os.Stdin)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" {
-				paths = append(paths, line)
-			}
+	if !fromStdin {
+		if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice != 0 {
+			return nil, nil
 		}
-		return paths, scanner.Err()
 	}
-	return nil, nil
+
+	paths, err := pcat.ReadFileList(os.Stdin, nul)
+	if err != nil {
+		return nil, fmt.Errorf("reading file list from stdin: %w", err)
+	}
+	// An empty list selects nothing rather than the current directory.
+	return append(append([]string{}, args...), paths...), nil
 }
 
 func init() {
@@ -74,7 +85,17 @@ func init() {
 	rootCmd.Flags().BoolVarP(&withLineNumbers, "with-line-numbers", "n", false, "Include line numbers")
 	rootCmd.Flags().BoolVar(&hidden, "hidden", false, "Include hidden files")
 	rootCmd.Flags().BoolVarP(&listOnly, "list", "l", false, "List files only")
+	rootCmd.Flags().BoolVar(&fromStdin, "stdin", false, "Also read paths from stdin")
+	rootCmd.Flags().BoolVarP(&nul, "null", "0", false, "Paths on stdin and in --list output are NUL-separated")
 	rootCmd.Flags().BoolVarP(&toClipboard, "clipboard", "c", false, "Copy to clipboard")
+	rootCmd.Flags().StringVar(&format, "format", pcat.FormatMarkdown, "Output format: markdown, xml or json")
+	rootCmd.Flags().BoolVar(&outline, "outline", false, "Print declarations and signatures only")
+	rootCmd.Flags().BoolVar(&gitSel.Changed, "changed", false, "Only files that differ from HEAD")
+	rootCmd.Flags().BoolVar(&gitSel.Staged, "staged", false, "Only files with staged changes")
+	rootCmd.Flags().BoolVar(&gitSel.Untracked, "untracked", false, "Only untracked files that are not ignored")
+	rootCmd.Flags().StringVar(&gitSel.Since, "since", "", "Only files changed since the merge base with this ref")
+	rootCmd.Flags().BoolVar(&withDiff, "diff", false, "With a git selector, also print the git diff of the selected files")
+	rootCmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Pack the output within this many tokens, replacing files that do not fit with a placeholder")
 }
 
 func main() {
@@ -93,19 +114,48 @@ func run(args []string) error {
 	}
 
 	var directories, specificFiles []string
+	var diff string
+	if !gitSel.IsZero() {
+		if specificFiles, err = gitFiles(paths); err != nil {
+			return err
+		}
+		if withDiff {
+			if diff, err = sf.GitDiff(gitSel, specificFiles); err != nil {
+				return err
+			}
+		}
+		paths = nil
+	} else if withDiff {
+		return fmt.Errorf("--diff requires --changed, --staged, --untracked or --since")
+	}
+
 	for _, path := range paths {
-		info, err := os.Stat(path)
+		info, err := os.Stat(pcat.ParseSelector(path).Path)
 		if err != nil {
 			return fmt.Errorf("invalid path '%s': %w", path, err)
 		}
-		if info.IsDir() {
+		if info.IsDir() && pcat.ParseSelector(path).IsWhole() {
 			directories = append(directories, path)
 		} else {
 			specificFiles = append(specificFiles, path)
 		}
 	}
 
-	output, err := pcat.Run(specificFiles, directories, extensions, excludePatterns, withLineNumbers, hidden, listOnly)
+	output, err := pcat.RunWithOptions(pcat.Options{
+		SpecificFiles:   specificFiles,
+		Directories:     directories,
+		Extensions:      extensions,
+		ExcludePatterns: excludePatterns,
+		WithLineNumbers: withLineNumbers,
+		Hidden:          hidden,
+		ListOnly:        listOnly,
+		MaxTokens:       maxTokens,
+		CountTokens:     token.Count,
+		Outline:         outline,
+		Format:          format,
+		Diff:            diff,
+		Nul:             nul,
+	})
 	if err != nil {
 		return err
 	}
@@ -119,3 +169,23 @@ func run(args []string) error {
 	}
 	return nil
 }
+
+// gitFiles returns the files under paths selected by the git flags, keeping
+// only the requested extensions.
+func gitFiles(paths []string) ([]string, error) {
+	files, err := sf.GitFiles(paths, gitSel, nil, hidden)
+	if err != nil {
+		return nil, err
+	}
+	if len(extensions) == 0 {
+		return files, nil
+	}
+
+	var kept []string
+	for _, f := range files {
+		if slices.Contains(extensions, strings.TrimPrefix(filepath.Ext(f), ".")) {
+			kept = append(kept, f)
+		}
+	}
+	return kept, nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 
 	"github.com/sokinpui/coder/pkg/sf"
 	"github.com/sokinpui/coder/pkg/version"
@@ -10,28 +13,184 @@ import (
 )
 
 func main() {
-	var fileType string
-	var excludes []string
-	var showHidden bool
+	var opts sf.Options
+	var nul bool
+	var gitSel sf.GitSelection
+	var pattern, minSize, maxSize, changedWithin, changedBefore string
+	var search sf.SearchOptions
+	var filesWithMatches, jsonOutput bool
 
 	rootCmd := &cobra.Command{
-		Use:     "sf [path]",
-		Short:   "A fast directory walker",
-		Version: version.Get(),
-		Args:    cobra.ArbitraryArgs,
-		Run: func(cmd *cobra.Command, args []string) {
-			results := sf.Run(args, fileType, excludes, showHidden)
+		Use:   "sf [path]",
+		Short: "A fast directory walker",
+		Long: `A fast directory walker that respects .gitignore.
+
+With --search, sf searches the content of the files it finds and prints
+path:line:column:text for every matching line, or JSON lines with --json.
+It exits with status 1 when nothing matches.`,
+		Version:      version.Get(),
+		Args:         cobra.ArbitraryArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := parseFilters(&opts, pattern, minSize, maxSize, changedWithin, changedBefore); err != nil {
+				return err
+			}
+
+			var results []string
+			if gitSel.IsZero() {
+				if search.Pattern == "" {
+					results = sf.RunWithOptions(args, opts)
+				}
+			} else {
+				if opts.Type == "dir" {
+					return fmt.Errorf("git selectors only select files")
+				}
+				files, err := sf.GitFiles(args, gitSel, opts.Excludes, opts.Hidden)
+				if err != nil {
+					return err
+				}
+				for _, f := range files {
+					if info, err := os.Stat(f); err == nil && opts.Match(f, info) {
+						results = append(results, f)
+					}
+				}
+				if search.Pattern != "" && len(results) == 0 {
+					os.Exit(1)
+				}
+			}
+
+			sep := "\n"
+			if nul {
+				sep = "\x00"
+			}
+			out := bufio.NewWriter(os.Stdout)
+
+			if search.Pattern != "" {
+				// Git-selected files are searched as roots of their own.
+				roots := args
+				if !gitSel.IsZero() {
+					roots = results
+				}
+				matches, err := sf.Search(roots, opts, search)
+				if err != nil {
+					return err
+				}
+				if len(matches) == 0 {
+					// Like grep, exit with status 1 when nothing matches.
+					os.Exit(1)
+				}
+				switch {
+				case filesWithMatches:
+					results = matchedFiles(matches)
+				case jsonOutput:
+					enc := json.NewEncoder(out)
+					for _, m := range matches {
+						if err := enc.Encode(m); err != nil {
+							return err
+						}
+					}
+					return out.Flush()
+				default:
+					printMatches(out, matches, search.Context > 0)
+					return out.Flush()
+				}
+			}
+
 			for _, path := range results {
-				fmt.Println(path)
+				out.WriteString(path + sep)
 			}
+			return out.Flush()
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&fileType, "type", "t", "", "Filter by type: file, dir")
-	rootCmd.Flags().StringSliceVarP(&excludes, "exclude", "E", []string{}, "Exclude patterns")
-	rootCmd.Flags().BoolVarP(&showHidden, "hidden", "H", false, "Search hidden files")
+	rootCmd.Flags().StringVarP(&opts.Type, "type", "t", "", "Filter by type: file, dir")
+	rootCmd.Flags().StringSliceVarP(&opts.Excludes, "exclude", "E", []string{}, "Exclude patterns")
+	rootCmd.Flags().BoolVarP(&opts.Hidden, "hidden", "H", false, "Search hidden files")
+	rootCmd.Flags().BoolVarP(&nul, "null", "0", false, "Separate paths with NUL bytes instead of newlines")
+	rootCmd.Flags().StringSliceVarP(&opts.Extensions, "extension", "e", nil, "Only files with these extensions")
+	rootCmd.Flags().StringVarP(&opts.Glob, "glob", "g", "", "Only entries whose name matches this glob")
+	rootCmd.Flags().StringVar(&pattern, "regex", "", "Only entries whose name matches this regular expression")
+	rootCmd.Flags().StringVar(&minSize, "min-size", "", "Only files of at least this size, e.g. 10k")
+	rootCmd.Flags().StringVar(&maxSize, "max-size", "", "Only files of at most this size, e.g. 1M")
+	rootCmd.Flags().StringVar(&changedWithin, "changed-within", "", "Only entries modified within this duration, e.g. 1d, 2h")
+	rootCmd.Flags().StringVar(&changedBefore, "changed-before", "", "Only entries modified longer ago than this duration")
+	rootCmd.Flags().IntVarP(&opts.MaxDepth, "max-depth", "d", 0, "Descend at most this many levels below each path")
+	rootCmd.Flags().BoolVarP(&opts.FollowSymlinks, "follow", "L", false, "Follow symlinked directories")
+	rootCmd.Flags().StringVarP(&search.Pattern, "search", "s", "", "Search file contents for this regular expression")
+	rootCmd.Flags().BoolVarP(&search.Literal, "fixed-strings", "F", false, "Search for the pattern as a literal string")
+	rootCmd.Flags().BoolVarP(&search.IgnoreCase, "ignore-case", "i", false, "Search case-insensitively")
+	rootCmd.Flags().BoolVarP(&search.SmartCase, "smart-case", "S", false, "Search case-insensitively unless the pattern has upper case letters")
+	rootCmd.Flags().IntVarP(&search.Context, "context", "C", 0, "Show this many lines around each match")
+	rootCmd.Flags().IntVarP(&search.MaxMatches, "max-count", "m", 0, "Stop searching a file after this many matching lines")
+	rootCmd.Flags().BoolVarP(&filesWithMatches, "files-with-matches", "l", false, "Print only the paths of files with matches")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print matches as JSON lines")
+	rootCmd.Flags().BoolVar(&gitSel.Changed, "changed", false, "Only files that differ from HEAD")
+	rootCmd.Flags().BoolVar(&gitSel.Staged, "staged", false, "Only files with staged changes")
+	rootCmd.Flags().BoolVar(&gitSel.Untracked, "untracked", false, "Only untracked files that are not ignored")
+	rootCmd.Flags().StringVar(&gitSel.Since, "since", "", "Only files changed since the merge base with this ref")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
+
+func parseFilters(opts *sf.Options, pattern, minSize, maxSize, changedWithin, changedBefore string) error {
+	var err error
+	if pattern != "" {
+		if opts.Pattern, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid --regex: %w", err)
+		}
+	}
+	if minSize != "" {
+		if opts.MinSize, err = sf.ParseSize(minSize); err != nil {
+			return err
+		}
+	}
+	if maxSize != "" {
+		if opts.MaxSize, err = sf.ParseSize(maxSize); err != nil {
+			return err
+		}
+	}
+	if changedWithin != "" {
+		if opts.ChangedWithin, err = sf.ParseAge(changedWithin); err != nil {
+			return err
+		}
+	}
+	if changedBefore != "" {
+		if opts.ChangedBefore, err = sf.ParseAge(changedBefore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchedFiles(matches []sf.Match) []string {
+	var files []string
+	for _, m := range matches {
+		if len(files) == 0 || files[len(files)-1] != m.Path {
+			files = append(files, m.Path)
+		}
+	}
+	return files
+}
+
+// printMatches prints path:line:column:text for each match and, like grep,
+// path-line-text for context lines, with "--" between groups that are not
+// adjacent.
+func printMatches(out *bufio.Writer, matches []sf.Match, withContext bool) {
+	lastPath, lastLine := "", 0
+	for _, m := range matches {
+		first := m.Line - len(m.Before)
+		if withContext && lastPath != "" && (m.Path != lastPath || first > lastLine+1) {
+			out.WriteString("--\n")
+		}
+		for i, text := range m.Before {
+			fmt.Fprintf(out, "%s-%d-%s\n", m.Path, first+i, text)
+		}
+		fmt.Fprintf(out, "%s:%d:%d:%s\n", m.Path, m.Line, m.Column, m.Text)
+		for i, text := range m.After {
+			fmt.Fprintf(out, "%s-%d-%s\n", m.Path, m.Line+1+i, text)
+		}
+		lastPath, lastLine = m.Path, m.Line+len(m.After)
+	}
+}
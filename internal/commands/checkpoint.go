@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/sokinpui/coder/internal/config"
+	"github.com/sokinpui/coder/internal/types"
+	"github.com/sokinpui/coder/internal/utils"
+)
+
+var checkpointSubcommands = []string{"list", "diff", "restore"}
+
+func init() {
+	registerCommand("checkpoint", checkpointCmd, "list, diff or restore git checkpoints of applied changes", checkpointArgumentCompleter)
+}
+
+func checkpointArgumentCompleter(cfg *config.Config, prefix string) []string {
+	return checkpointSubcommands
+}
+
+// CheckpointBase snapshots the working tree before an apply when checkpoints
+// are enabled, and returns "" otherwise.
+func CheckpointBase(s SessionController) string {
+	if !s.GetConfig().Itf.Checkpoints || !utils.IsGitRepo() {
+		return ""
+	}
+	base, err := utils.SnapshotWorktree()
+	if err != nil {
+		log.Printf("failed to snapshot working tree: %v", err)
+	}
+	return base
+}
+
+// SaveCheckpoint records the files touched by an apply as a commit on the
+// session's checkpoint ref when checkpoints are enabled. base is the
+// CheckpointBase taken before the apply.
+func SaveCheckpoint(res ItfResult, s SessionController, base string) {
+	if !s.GetConfig().Itf.Checkpoints || !res.HasChanges() || !utils.IsGitRepo() {
+		return
+	}
+
+	var paths []string
+	paths = append(paths, res.Raw["Created"]...)
+	paths = append(paths, res.Raw["Modified"]...)
+	paths = append(paths, res.Raw["Deleted"]...)
+	for _, r := range res.Raw["Renamed"] {
+		if oldPath, newPath, ok := strings.Cut(r, " -> "); ok {
+			paths = append(paths, oldPath, newPath)
+		}
+	}
+
+	subject := "coder: " + strings.Join(paths, ", ")
+	if len(subject) > 72 {
+		subject = fmt.Sprintf("coder: %d files", len(paths))
+	}
+	if _, err := utils.CreateCheckpoint(s.GetID(), subject+"\n\n"+res.Summary, paths, base); err != nil {
+		log.Printf("failed to create checkpoint: %v", err)
+	}
+}
+
+func checkpointCmd(args string, s SessionController) (CommandOutput, bool) {
+	fields := strings.Fields(args)
+	sub := "list"
+	if len(fields) > 0 {
+		sub = fields[0]
+	}
+
+	checkpoints, err := utils.ListCheckpoints(s.GetID())
+	if err != nil {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Failed to read checkpoints: %v", err)}, false
+	}
+
+	if sub == "list" {
+		if len(checkpoints) == 0 {
+			return CommandOutput{Type: types.MessagesUpdated, Payload: "No checkpoints in this session. Enable them with itf.checkpoints in the config."}, true
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "Checkpoints (%s):\n", utils.CheckpointRef(s.GetID()))
+		for i, c := range checkpoints {
+			fmt.Fprintf(&b, "%d. %s %s %s\n", i+1, c.Commit[:8], c.Time.Format("15:04:05"), c.Subject)
+		}
+		fmt.Fprint(&b, "Usage: /checkpoint diff <n> | /checkpoint restore <n>")
+		return CommandOutput{Type: types.MessagesUpdated, Payload: b.String()}, true
+	}
+
+	if sub != "diff" && sub != "restore" {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Unknown subcommand '%s'. Available: %s", sub, strings.Join(checkpointSubcommands, ", "))}, false
+	}
+	if len(fields) < 2 {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Usage: /checkpoint %s <n>", sub)}, false
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 1 || n > len(checkpoints) {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Invalid checkpoint: %s", fields[1])}, false
+	}
+	commit := checkpoints[n-1].Commit
+
+	if sub == "diff" {
+		diff, err := utils.CheckpointDiff(commit)
+		if err != nil {
+			return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Failed to diff checkpoint: %v", err)}, false
+		}
+		return CommandOutput{Type: types.MessagesUpdated, Payload: "```diff\n" + diff + "\n```"}, true
+	}
+
+	restored, err := utils.RestoreCheckpoint(commit)
+	if err != nil {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Failed to restore checkpoint: %v", err)}, false
+	}
+	_ = s.LoadContext()
+	return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Restored from checkpoint %d:\n  %s", n, strings.Join(restored, "\n  "))}, true
+}
@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sokinpui/coder/internal/config"
+	"github.com/sokinpui/coder/internal/generation"
+	"github.com/sokinpui/coder/internal/prompt"
+	"github.com/sokinpui/coder/internal/redact"
+	"github.com/sokinpui/coder/internal/types"
+	"github.com/sokinpui/coder/internal/utils"
+)
+
+const (
+	commitTimeout       = 60 * time.Second
+	maxCommitDiffLength = 60000
+)
+
+func init() {
+	registerCommand("commit", commitCmd, "generate a commit message and commit", nil)
+}
+
+// commitCmd only starts the commit: the UI prepares it with PrepareCommit off
+// the update loop, since staging and generating the message take a while.
+func commitCmd(args string, s SessionController) (CommandOutput, bool) {
+	return CommandOutput{Type: types.CommitStarted}, true
+}
+
+// PrepareCommit generates a commit message for the staged changes and writes
+// it to a temporary file for `git commit -F`. When nothing is staged, the
+// given paths (usually the files changed by the last apply) are staged first
+// and returned, so the caller can unstage them with utils.UnstagePaths if the
+// commit is abandoned. They are unstaged already when PrepareCommit fails.
+func PrepareCommit(cfg *config.Config, paths []string) (messageFile string, staged []string, err error) {
+	if !utils.IsGitRepo() {
+		return "", nil, fmt.Errorf("not a git repository")
+	}
+
+	diff, err := utils.StagedDiff()
+	if err != nil {
+		return "", nil, err
+	}
+	if diff == "" && len(paths) > 0 {
+		if err := utils.StagePaths(paths); err != nil {
+			return "", nil, err
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			if unstageErr := utils.UnstagePaths(paths); unstageErr != nil {
+				err = fmt.Errorf("%w (and failed to unstage %s: %v)", err, strings.Join(paths, ", "), unstageErr)
+			}
+		}()
+		staged = paths
+		if diff, err = utils.StagedDiff(); err != nil {
+			return "", nil, err
+		}
+	}
+	if diff == "" {
+		return "", nil, fmt.Errorf("nothing to commit: no staged changes and no files from the last apply")
+	}
+
+	message, err := GenerateCommitMessage(cfg, diff)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate commit message: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "coder-commit-*.txt")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(message + "\n"); err != nil {
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+	return f.Name(), staged, nil
+}
+
+func GenerateCommitMessage(cfg *config.Config, diff string) (string, error) {
+	template := prompt.CommitMessagePrompt
+	if cfg.Commit.Template != "" {
+		path := cfg.Commit.Template
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			path = filepath.Join(utils.UserHomeDir(), rest)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read commit template: %w", err)
+		}
+		template = string(data)
+	}
+
+	if cfg.Redact.Enabled {
+		r, _ := redact.New(cfg.Redact, nil)
+		diff, _ = r.Redact(diff, "diff")
+	}
+
+	diff = truncateDiff(diff, maxCommitDiffLength)
+
+	gen, err := generation.New(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+	defer cancel()
+	message, err := gen.GenerateCommitMessage(ctx, strings.Replace(template, "{{DIFF}}", diff, 1))
+	if err != nil {
+		return "", err
+	}
+	return stripCodeFence(message), nil
+}
+
+// truncateDiff cuts diff to at most max bytes after its last whole line, or
+// at a rune boundary when the first line alone is longer.
+func truncateDiff(diff string, max int) string {
+	if len(diff) <= max {
+		return diff
+	}
+	cut := strings.LastIndexByte(diff[:max], '\n')
+	if cut < 0 {
+		cut = max
+		for cut > 0 && !utf8.RuneStart(diff[cut]) {
+			cut--
+		}
+	}
+	return diff[:cut] + "\n... (diff truncated)"
+}
+
+// stripCodeFence removes a fence the model wrapped the message in despite the
+// instructions.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	lines = lines[1:]
+	if len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "```") {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
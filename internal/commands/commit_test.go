@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateDiff(t *testing.T) {
+	const note = "\n... (diff truncated)"
+	tests := []struct {
+		diff string
+		max  int
+		want string
+	}{
+		{"+a\n+b\n", 10, "+a\n+b\n"},
+		{"+a\n+bcd\n", 6, "+a" + note},
+		{"+a\n+b\n+c\n", 6, "+a\n+b" + note},
+		{"+héllo", 3, "+h" + note},
+		{"+日本語", 3, "+" + note},
+	}
+	for _, tt := range tests {
+		got := truncateDiff(tt.diff, tt.max)
+		if got != tt.want {
+			t.Errorf("truncateDiff(%q, %d) = %q, want %q", tt.diff, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateDiff(%q, %d) is not valid UTF-8", tt.diff, tt.max)
+		}
+	}
+}
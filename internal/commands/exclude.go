@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"github.com/sokinpui/coder/internal/types"
+	"github.com/sokinpui/coder/pkg/pcat"
 	"path/filepath"
 	"strings"
 )
@@ -44,12 +45,17 @@ func excludeCmd(args string, s SessionController) (CommandOutput, bool) {
 	return CommandOutput{Type: types.MessagesUpdated, Payload: payload.String()}, true
 }
 
+// filterPaths drops the listed paths and any selector on one of them.
 func filterPaths(original []string, toRemove map[string]struct{}) []string {
 	filtered := make([]string, 0, len(original))
 	for _, p := range original {
-		if _, found := toRemove[p]; !found {
-			filtered = append(filtered, p)
+		if _, found := toRemove[p]; found {
+			continue
 		}
+		if _, found := toRemove[pcat.ParseSelector(p).Path]; found {
+			continue
+		}
+		filtered = append(filtered, p)
 	}
 	return filtered
 }
@@ -6,8 +6,13 @@ import (
 	"github.com/sokinpui/coder/internal/source"
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/internal/utils"
+	"github.com/sokinpui/coder/pkg/pcat"
+	"github.com/sokinpui/coder/pkg/sf"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -45,10 +50,54 @@ func PathArgumentCompleter(cfg *config.Config, prefix string) []string {
 }
 
 func fileCmd(args string, s SessionController) (CommandOutput, bool) {
-	paths := strings.Fields(args)
+	var paths []string
+	var gitSel sf.GitSelection
+	var filter sf.Options
+	filtered := false
+	outline := false
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		switch arg := fields[i]; {
+		case arg == "--outline":
+			outline = true
+		case arg == "--follow":
+			filter.FollowSymlinks = true
+			filtered = true
+		case slices.Contains(fileFilterFlags, arg):
+			if i+1 == len(fields) {
+				return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Usage: /file %s <value> [paths...]", arg)}, false
+			}
+			i++
+			if err := parseFileFilter(&filter, arg, fields[i]); err != nil {
+				return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Error: %v", err)}, false
+			}
+			filtered = true
+		case arg == "--changed":
+			gitSel.Changed = true
+		case arg == "--staged":
+			gitSel.Staged = true
+		case arg == "--untracked":
+			gitSel.Untracked = true
+		case arg == "--since":
+			if i+1 == len(fields) {
+				return CommandOutput{Type: types.MessagesUpdated, Payload: "Usage: /file --since <ref> [paths...]"}, false
+			}
+			i++
+			gitSel.Since = fields[i]
+		default:
+			paths = append(paths, arg)
+		}
+	}
 
-	if len(paths) == 0 {
+	if filtered && len(paths) == 0 && gitSel.IsZero() {
+		paths = []string{"."}
+	}
+	if outline && len(paths) == 0 && gitSel.IsZero() {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: "Usage: /file --outline <paths...>"}, false
+	}
+	if len(paths) == 0 && gitSel.IsZero() {
 		s.SetContextFiles([]string{})
+		s.SetExplicitFiles(nil)
 		if err := s.LoadContext(); err != nil {
 			msg := fmt.Sprintf("Project context cleared, but failed to reload context: %v", err)
 			return CommandOutput{Type: types.MessagesUpdated, Payload: msg}, false
@@ -58,12 +107,39 @@ func fileCmd(args string, s SessionController) (CommandOutput, bool) {
 
 	var files []string
 	var dirs []string
+	var explicit []string
 	var invalidPaths []string
 
+	cfg := s.GetConfig()
+	allExclusions := append([]string{}, source.Exclusions...)
+	allExclusions = append(allExclusions, cfg.Context.Exclusions...)
+
+	if !gitSel.IsZero() {
+		var err error
+		files, err = sf.GitFiles(paths, gitSel, allExclusions, true)
+		if err != nil {
+			return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Error selecting files with git: %v", err)}, false
+		}
+		if len(files) == 0 {
+			return CommandOutput{Type: types.MessagesUpdated, Payload: "No files match the git selection."}, false
+		}
+		paths = nil
+	}
+
 	expandedPaths, invalidPatterns := ExpandPaths(paths)
 	invalidPaths = append(invalidPaths, invalidPatterns...)
 
+	var selectors []string
 	for _, p := range expandedPaths {
+		if sel := pcat.ParseSelector(p); !sel.IsWhole() {
+			if err := checkSelector(sel); err != nil {
+				invalidPaths = append(invalidPaths, fmt.Sprintf("%s (%v)", p, err))
+				continue
+			}
+			selectors = append(selectors, filepath.ToSlash(p))
+			continue
+		}
+
 		info, err := os.Stat(p)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -76,16 +152,33 @@ func fileCmd(args string, s SessionController) (CommandOutput, bool) {
 			dirs = append(dirs, p)
 		} else {
 			files = append(files, p)
+			explicit = append(explicit, p)
 		}
 	}
 
-	currentFiles := s.GetContextFiles()
-	cfg := s.GetConfig()
-	allExclusions := append([]string{}, source.Exclusions...)
-	allExclusions = append(allExclusions, cfg.Context.Exclusions...)
+	if filtered {
+		explicit = filterFiles(explicit, filter)
+		files = filterFiles(files, filter)
+		filter.Type, filter.Excludes, filter.Hidden = "file", allExclusions, true
+		files = append(files, sf.RunWithOptions(dirs, filter)...)
+		dirs = nil
+		if len(files) == 0 && len(selectors) == 0 {
+			return CommandOutput{Type: types.MessagesUpdated, Payload: "No files match the filters."}, false
+		}
+	}
 
+	currentFiles := s.GetContextFiles()
 	newResolvedFiles, _ := utils.SourceToFileList(dirs, files, allExclusions)
+	if outline {
+		for i, f := range newResolvedFiles {
+			newResolvedFiles[i] = pcat.Selector{Path: f, Outline: true}.String()
+		}
+	}
+	newResolvedFiles = append(newResolvedFiles, selectors...)
+	currentFiles = dropReplacedViews(currentFiles, newResolvedFiles)
 	s.SetContextFiles(AppendUnique(currentFiles, newResolvedFiles))
+	explicit = append(append(explicit, selectors...), s.GetExplicitFiles()...)
+	s.SetExplicitFiles(explicit)
 
 	if err := s.LoadContext(); err != nil {
 		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Project context updated, but failed to reload context: %v", err)}, false
@@ -105,3 +198,80 @@ func fileCmd(args string, s SessionController) (CommandOutput, bool) {
 
 	return CommandOutput{Type: types.FileViewerStarted, Payload: payload.String()}, true
 }
+
+// fileFilterFlags are the /file options that take a value and filter the
+// files found in the given paths.
+var fileFilterFlags = []string{"--ext", "--name", "--regex", "--min-size", "--max-size", "--changed-within", "--changed-before", "--max-depth"}
+
+func parseFileFilter(filter *sf.Options, flag, value string) error {
+	var err error
+	switch flag {
+	case "--ext":
+		filter.Extensions = append(filter.Extensions, strings.Split(value, ",")...)
+	case "--name":
+		if _, err = filepath.Match(value, ""); err != nil {
+			return fmt.Errorf("invalid --name pattern %q: %w", value, err)
+		}
+		filter.Glob = value
+	case "--regex":
+		if filter.Pattern, err = regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid --regex: %w", err)
+		}
+	case "--min-size":
+		filter.MinSize, err = sf.ParseSize(value)
+	case "--max-size":
+		filter.MaxSize, err = sf.ParseSize(value)
+	case "--changed-within":
+		filter.ChangedWithin, err = sf.ParseAge(value)
+	case "--changed-before":
+		filter.ChangedBefore, err = sf.ParseAge(value)
+	case "--max-depth":
+		if filter.MaxDepth, err = strconv.Atoi(value); err != nil || filter.MaxDepth < 1 {
+			return fmt.Errorf("invalid --max-depth %q", value)
+		}
+	}
+	return err
+}
+
+// filterFiles keeps the files that pass the filter.
+func filterFiles(files []string, filter sf.Options) []string {
+	var kept []string
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && filter.Match(f, info) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// checkSelector reports a selector whose file is missing or whose line range
+// or symbol cannot be found, so it is not added to the context silently empty.
+func checkSelector(sel pcat.Selector) error {
+	content, err := os.ReadFile(sel.Path)
+	if err != nil {
+		return err
+	}
+	_, _, err = sel.Lines(content)
+	return err
+}
+
+// dropReplacedViews removes the whole-file or outline entry of a file that is
+// being added in the other form, so a file is not sent both ways.
+func dropReplacedViews(current, added []string) []string {
+	replaced := make(map[string]bool)
+	for _, p := range added {
+		if sel := pcat.ParseSelector(p); sel.IsWhole() || sel.Outline {
+			replaced[sel.Path] = sel.Outline
+		}
+	}
+
+	kept := make([]string, 0, len(current))
+	for _, p := range current {
+		sel := pcat.ParseSelector(p)
+		if outline, ok := replaced[sel.Path]; ok && (sel.IsWhole() || sel.Outline) && outline != sel.Outline {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
@@ -0,0 +1,198 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/sokinpui/coder/internal/source"
+	"github.com/sokinpui/coder/internal/types"
+	"github.com/sokinpui/coder/pkg/pcat"
+	"github.com/sokinpui/coder/pkg/sf"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	grepDefaultContext = 3
+	// grepMaxListed is how many matching lines the command result shows.
+	grepMaxListed = 20
+)
+
+func init() {
+	registerCommand("grep", grepCmd, "add files or regions matching a pattern to context", PathArgumentCompleter)
+}
+
+const grepUsage = "Usage: /grep [-i] [-S] [-F] [-C <n>] [--files] [/file filters] [--] <pattern> [paths...]"
+
+func grepCmd(args string, s SessionController) (CommandOutput, bool) {
+	search := sf.SearchOptions{Context: grepDefaultContext}
+	var filter sf.Options
+	var paths []string
+	wholeFiles := false
+	fields, err := splitArgs(args)
+	if err != nil {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Error: %v\n%s", err, grepUsage)}, false
+	}
+	// Options may follow the pattern; after "--" every argument is the
+	// pattern or a path, even one starting with "-".
+	positional := false
+	for i := 0; i < len(fields); i++ {
+		switch arg := fields[i]; {
+		case positional || !strings.HasPrefix(arg, "-") || arg == "-":
+			if search.Pattern == "" {
+				search.Pattern = arg
+			} else {
+				paths = append(paths, arg)
+			}
+		case arg == "--":
+			positional = true
+		case arg == "-i":
+			search.IgnoreCase = true
+		case arg == "-S":
+			search.SmartCase = true
+		case arg == "-F":
+			search.Literal = true
+		case arg == "--files":
+			wholeFiles = true
+		case arg == "--follow":
+			filter.FollowSymlinks = true
+		case arg == "-C" || slices.Contains(fileFilterFlags, arg):
+			if i+1 == len(fields) {
+				return CommandOutput{Type: types.MessagesUpdated, Payload: grepUsage}, false
+			}
+			i++
+			if arg == "-C" {
+				n, err := strconv.Atoi(fields[i])
+				if err != nil || n < 0 {
+					return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Error: invalid context %q", fields[i])}, false
+				}
+				search.Context = n
+			} else if err := parseFileFilter(&filter, arg, fields[i]); err != nil {
+				return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Error: %v", err)}, false
+			}
+		default:
+			return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Unknown option %s\n%s", arg, grepUsage)}, false
+		}
+	}
+	if search.Pattern == "" {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: grepUsage}, false
+	}
+
+	cfg := s.GetConfig()
+	filter.Excludes = append(append([]string{}, source.Exclusions...), cfg.Context.Exclusions...)
+	filter.Hidden = true
+
+	matches, err := sf.Search(paths, filter, search)
+	if err != nil {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Error: %v", err)}, false
+	}
+	if len(matches) == 0 {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("No matches for %s.", search.Pattern)}, false
+	}
+
+	currentFiles := s.GetContextFiles()
+	added := grepContextFiles(matches, currentFiles, wholeFiles)
+	if wholeFiles {
+		// The whole file replaces regions and outlines of it.
+		replaced := make(map[string]struct{}, len(added))
+		for _, f := range added {
+			replaced[f] = struct{}{}
+		}
+		currentFiles = filterPaths(currentFiles, replaced)
+	}
+	s.SetContextFiles(AppendUnique(currentFiles, added))
+
+	if err := s.LoadContext(); err != nil {
+		return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Project context updated, but failed to reload context: %v", err)}, false
+	}
+
+	var payload strings.Builder
+	fmt.Fprintf(&payload, "Project context updated with %d matching lines.\n", len(matches))
+	for i, m := range matches {
+		if i == grepMaxListed {
+			fmt.Fprintf(&payload, "... and %d more\n", len(matches)-grepMaxListed)
+			break
+		}
+		fmt.Fprintf(&payload, "%s:%d: %s\n", filepath.ToSlash(m.Path), m.Line, strings.TrimSpace(m.Text))
+	}
+	payload.WriteString(formatFileListSummary(s.GetContextFiles()))
+
+	return CommandOutput{Type: types.MessagesUpdated, Payload: payload.String()}, true
+}
+
+// grepContextFiles returns the matching files or, unless wholeFiles is set,
+// a line range selector for each matched region. Files already in the
+// context as a whole get no regions.
+func grepContextFiles(matches []sf.Match, current []string, wholeFiles bool) []string {
+	var files []string
+	for _, m := range matches {
+		if p := filepath.ToSlash(m.Path); len(files) == 0 || files[len(files)-1] != p {
+			files = append(files, p)
+		}
+	}
+	if wholeFiles {
+		return files
+	}
+
+	regions := sf.Regions(matches)
+	var added []string
+	for _, f := range files {
+		if slices.Contains(current, f) {
+			continue
+		}
+		for _, r := range regions[filepath.FromSlash(f)] {
+			added = append(added, pcat.Selector{Path: f, Start: r[0], End: r[1]}.String())
+		}
+	}
+	return added
+}
+
+// splitArgs splits args at unquoted whitespace. Single quotes keep their
+// content as is; within double quotes, \" and \\ stand for " and \. Other
+// backslashes are kept, so regular expressions need no extra escaping.
+func splitArgs(args string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	inField := false
+	var quote rune
+	runes := []rune(args)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else if c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				cur.WriteRune(runes[i])
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inField = c, true
+		case unicode.IsSpace(c):
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(c)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{`foo -i`, []string{"foo", "-i"}},
+		{`"func main" cmd/`, []string{"func main", "cmd/"}},
+		{`'a "b"' c`, []string{`a "b"`, "c"}},
+		{`"say \"hi\"" "a\\b" "\d+"`, []string{`say "hi"`, `a\b`, `\d+`}},
+		{`\bword\b  x`, []string{`\bword\b`, "x"}},
+		{`-- -x ""`, []string{"--", "-x", ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := splitArgs(`"open`); err == nil {
+		t.Error("unterminated quote accepted")
+	}
+}
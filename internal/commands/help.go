@@ -29,14 +29,17 @@ var behaviorGroup = helpGroup{
 var commandGroup = helpGroup{
 	{key: "branch", desc: "Enter branch mode to branch from a message."},
 	{key: "chat", desc: "Start a new chat session with no context/instructions."},
+	{key: "checkpoint", desc: "List, diff or restore git checkpoints of applied changes (list | diff <n> | restore <n>)."},
+	{key: "commit", desc: "Generate a commit message for the staged changes and commit."},
 	{key: "config", desc: "Print the current configuration."},
 	{key: "edit", desc: "Enter edit mode to edit a user prompt."},
 	{key: "exclude", desc: "Exclude a file/directory from the project source."},
-	{key: "file", desc: "Set project source files/directories. If no arguments, then clears all."},
+	{key: "file", desc: "Set project source files/directories (path:10-40 or path#Symbol for part of a file, --outline for signatures only, --changed/--staged/--untracked/--since <ref> to select by git status, --ext/--name/--regex/--min-size/--max-size/--changed-within/--changed-before/--max-depth/--follow to filter). If no arguments, then clears all."},
+	{key: "grep", desc: "Add the regions around lines matching a pattern to the project source (/grep [-i] [-S] [-F] [-C n] [--files] <pattern> [paths...]; --files adds whole files; /file filters such as --ext apply)."},
 	{key: "gen", desc: "Enter generate mode to re-generate a response."},
 	{key: "help", desc: "Show this help message."},
 	{key: "history", desc: "View conversation history."},
-	{key: "itf", desc: "Pipe the last AI response to `itf` for applying changes."},
+	{key: "itf", desc: "Pipe the last AI response to `itf` for applying changes (--force to patch stale files, --allow-large for binary or large files)."},
 	{key: "list", desc: "List the current project source files/directories."},
 	{key: "mode", desc: "Switch conversation mode (coding/chat)."},
 	{key: "model", desc: "Switch generation model (e.g., /model gemini-2.5-pro)."},
@@ -44,10 +47,12 @@ var commandGroup = helpGroup{
 	{key: "new", desc: "Start a new chat session."},
 	{key: "q", desc: "Quit the application."},
 	{key: "quit", desc: "Quit the application."},
+	{key: "repair", desc: "Ask the model to re-emit hunks that failed in the last apply."},
+	{key: "regen", desc: "Regenerate the last AI response against the current file content."},
 	{key: "rename", desc: "Rename the current session title."},
 	{key: "sh", desc: "Run non-interactive shell command (e.g. /sh go test ./...)."},
 	{key: "term", desc: "Run interactive terminal command or open subshell."},
-	{key: "undo", desc: "Undo the last file changes applied by itf."},
+	{key: "undo [n]", desc: "Undo this session's last itf changes, or those of message n."},
 }
 
 var globalGroup = helpGroup{
@@ -60,6 +65,7 @@ var globalGroup = helpGroup{
 	{key: "Ctrl+F", desc: "Search context files and open in editor."},
 	{key: "Ctrl+L", desc: "Quick view of project context (/list)."},
 	{key: "Ctrl+A", desc: "Apply last AI response with `itf`."},
+	{key: "Ctrl+R", desc: "Ask the model to repair hunks that failed to apply (/repair)."},
 	{key: "Ctrl+U / D", desc: "Scroll conversation view up / down."},
 	{key: "Ctrl+Z", desc: "Suspend the application."},
 	{key: "Tab", desc: "Autocomplete commands and arguments."},
@@ -75,6 +81,7 @@ var atomicMsgGroup = helpGroup{
 	{key: "y", desc: "Yank (copy) selected message(s) to clipboard."},
 	{key: "d", desc: "Delete selected message(s)."},
 	{key: "a", desc: "Apply code changes from AI response with itf."},
+	{key: "u", desc: "Undo the changes applied from the selected AI response."},
 	{key: "e", desc: "Edit selected user message in external editor."},
 	{key: "r", desc: "Regenerate conversation starting from message."},
 	{key: "b", desc: "Branch conversation into a new session."},
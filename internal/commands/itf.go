@@ -1,6 +1,10 @@
 package commands
 
 import (
+	"fmt"
+
+	"github.com/sokinpui/coder/internal/config"
+	"github.com/sokinpui/coder/internal/redact"
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/pkg/itf"
 	"strings"
@@ -8,21 +12,76 @@ import (
 
 func init() {
 	registerCommand("itf", itfCmd, "apply code changes", nil)
+	registerCommand("regen", regenCmd, "regenerate last response with current context", nil)
+	registerCommand("repair", repairCmd, "ask the model to re-emit failed hunks", nil)
 }
 
 type ItfResult struct {
 	Summary       string
 	AffectedFiles []string
 	Raw           map[string][]string
+	Result        itf.Result
 	Success       bool
 }
 
+const policyHint = "Some paths were blocked by the write policy. Use /itf --allow <path> to write them anyway."
+
+const repairHint = "Use /repair to send the failed hunks and the current file text back to the model."
+
+const staleHint = "Some files changed on disk after the prompt was built and were left untouched.\nUse /regen to regenerate against the current content, or /itf --force to apply anyway."
+
+// HasChanges reports whether the apply touched any file on disk.
+func (r ItfResult) HasChanges() bool {
+	return len(r.Raw["Created"]) > 0 ||
+		len(r.Raw["Modified"]) > 0 ||
+		len(r.Raw["Renamed"]) > 0 ||
+		len(r.Raw["Deleted"]) > 0
+}
+
+// NewItfConfig builds the itf settings shared by every apply path from the coder config.
+func NewItfConfig(cfg *config.Config) itf.Config {
+	var c itf.Config
+	if cfg == nil {
+		return c
+	}
+	for _, f := range cfg.Itf.Formatters {
+		c.Formatters = append(c.Formatters, itf.Formatter{Pattern: f.Pattern, Command: f.Command})
+	}
+	c.Protected = cfg.Itf.Protected
+	c.Placeholder = redact.PlaceholderPattern
+	return c
+}
+
+// NewSessionItfConfig builds the itf settings for applying the AI message at
+// msgIndex, tagging the resulting history entry with the session.
+func NewSessionItfConfig(s SessionController, msgIndex int) itf.Config {
+	config := NewItfConfig(s.GetConfig())
+	config.Baseline = s.GetContextHashes()
+	config.Restore = s.RestoreSecrets
+	config.SessionID = s.GetID()
+	config.MessageIndex = msgIndex
+	return config
+}
+
 // Use itf to apply file operations
-func ExecuteItf(content string, args string) ItfResult {
+func ExecuteItf(content string, args string, config itf.Config) ItfResult {
 	fields := strings.Fields(args)
-	config := itf.Config{}
 
-	for _, arg := range fields {
+	for i := 0; i < len(fields); i++ {
+		arg := fields[i]
+		if arg == "--force" {
+			config.Force = true
+			continue
+		}
+		if arg == "--allow-large" {
+			config.AllowLarge = true
+			continue
+		}
+		if arg == "--allow" && i+1 < len(fields) {
+			i++
+			config.Allow = append(config.Allow, fields[i])
+			continue
+		}
 		if strings.HasPrefix(arg, ".") {
 			config.Extensions = append(config.Extensions, arg)
 			continue
@@ -30,25 +89,46 @@ func ExecuteItf(content string, args string) ItfResult {
 		config.Files = append(config.Files, arg)
 	}
 
-	results, err := itf.Apply(content, config)
+	applied, err := itf.ApplySummary(content, config)
 	if err != nil {
-		return ItfResult{Summary: "Error applying changes: " + err.Error(), Success: false}
+		msg := "Error applying changes: " + err.Error()
+		return ItfResult{Summary: msg, Result: itf.Summary{Message: msg}.Result(), Success: false}
 	}
+	return newItfResult(applied)
+}
 
-	var affectedFiles []string
-	affectedFiles = append(affectedFiles, results["Created"]...)
-	affectedFiles = append(affectedFiles, results["Modified"]...)
+func newItfResult(applied itf.Summary) ItfResult {
+	results := applied.Map()
 
-	for _, p := range results["Renamed"] {
-		parts := strings.Split(p, " -> ")
-		if len(parts) == 2 {
-			affectedFiles = append(affectedFiles, parts[1])
+	var affectedFiles []string
+	policyBlocked := false
+	for _, r := range applied.Results {
+		if r.Status == itf.StatusFailed && r.ErrorKind == itf.ErrKindPolicy {
+			policyBlocked = true
+		}
+		if r.Status != itf.StatusApplied {
+			continue
+		}
+		switch r.Action {
+		case "create", "modify":
+			affectedFiles = append(affectedFiles, r.Path)
+		case "rename":
+			affectedFiles = append(affectedFiles, r.NewPath)
 		}
 	}
 
-	summary := itf.FormatResult(results)
+	summary := itf.FormatSummary(applied)
 	if summary == "" {
-		return ItfResult{Summary: "No changes applied.", Raw: results, Success: true}
+		return ItfResult{Summary: "No changes applied.", Raw: results, Result: applied.Result(), Success: true}
+	}
+	if policyBlocked {
+		summary += "\n" + policyHint
+	}
+	if len(results["Stale"]) > 0 {
+		summary += "\n" + staleHint
+	}
+	if BuildRepairPrompt(applied.Result()) != "" {
+		summary += "\n" + repairHint
 	}
 
 	// Remove duplicates
@@ -65,39 +145,86 @@ func ExecuteItf(content string, args string) ItfResult {
 		Summary:       summary,
 		AffectedFiles: uniqueFiles,
 		Raw:           results,
+		Result:        applied.Result(),
 		Success:       true,
 	}
 }
 
 func itfCmd(args string, s SessionController) (CommandOutput, bool) {
 	messages := s.GetMessages()
-	var lastAIResponse string
-	found := false
+	aiIndex := -1
 	for i := len(messages) - 1; i >= 0; i-- {
 		if messages[i].Type == types.AIMessage {
-			lastAIResponse = messages[i].Content
-			found = true
+			aiIndex = i
 			break
 		}
 	}
 
-	if !found {
+	if aiIndex < 0 {
 		return CommandOutput{Type: types.MessagesUpdated, Payload: "No AI response found to pipe to itf."}, false
 	}
 
-	res := ExecuteItf(lastAIResponse, args)
+	base := CheckpointBase(s)
+	res := ExecuteItf(messages[aiIndex].Content, args, NewSessionItfConfig(s, aiIndex))
 	s.SetLastModifiedFiles(res.AffectedFiles)
 
 	if !res.Success {
+		s.SetRepairPrompt("")
 		return CommandOutput{Type: types.MessagesUpdated, Payload: res.Summary}, false
 	}
 
+	recordItfResult(res, s, base)
+
+	outType := types.MessagesUpdated
+	if res.HasChanges() {
+		outType = types.ItfApplied
+	}
+	return CommandOutput{Type: outType, Payload: res.Summary}, res.Success
+}
+
+// StreamItf is a streaming applier together with the working tree snapshot
+// its checkpoint is based on.
+type StreamItf struct {
+	*itf.StreamApplier
+	checkpointBase string
+}
+
+// NewStreamItf returns an applier that writes code blocks while the response
+// streams, or nil when streaming apply is disabled.
+func NewStreamItf(s SessionController) *StreamItf {
+	if !s.GetConfig().Itf.StreamApply {
+		return nil
+	}
+	base := CheckpointBase(s)
+	// The response being streamed is the last message.
+	config := NewSessionItfConfig(s, len(s.GetMessages())-1)
+	applier, err := itf.NewStreamApplier(config)
+	if err != nil {
+		return nil
+	}
+	return &StreamItf{StreamApplier: applier, checkpointBase: base}
+}
+
+// FinishStreamItf records the streamed changes as one history entry and
+// updates the session like /itf does.
+func FinishStreamItf(applier *StreamItf, s SessionController) ItfResult {
+	applied, err := applier.Close()
+	if err != nil {
+		return ItfResult{Summary: "Error applying changes: " + err.Error(), Success: false}
+	}
+	res := newItfResult(applied)
+	s.SetLastModifiedFiles(res.AffectedFiles)
+	recordItfResult(res, s, applier.checkpointBase)
+	return res
+}
+
+func recordItfResult(res ItfResult, s SessionController, base string) {
+	s.SetRepairPrompt(BuildRepairPrompt(res.Result))
+
 	// Mark that this session has applied changes
-	if len(res.Raw["Created"]) > 0 ||
-		len(res.Raw["Modified"]) > 0 ||
-		len(res.Raw["Renamed"]) > 0 ||
-		len(res.Raw["Deleted"]) > 0 {
+	if res.HasChanges() {
 		s.SetHasAppliedChanges(true)
+		SaveCheckpoint(res, s, base)
 	}
 
 	// Update context paths based on itf results
@@ -140,6 +267,35 @@ func itfCmd(args string, s SessionController) (CommandOutput, bool) {
 		s.SetContextFiles(currentFiles)
 		_ = s.LoadContext()
 	}
+}
+
+func regenCmd(args string, s SessionController) (CommandOutput, bool) {
+	return CommandOutput{Type: types.RegenerateStarted}, true
+}
+
+func repairCmd(args string, s SessionController) (CommandOutput, bool) {
+	return CommandOutput{Type: types.RepairStarted}, true
+}
 
-	return CommandOutput{Type: types.MessagesUpdated, Payload: res.Summary}, res.Success
+// BuildRepairPrompt describes every hunk that failed to match together with
+// the current text of the region it most likely targeted.
+func BuildRepairPrompt(result itf.Result) string {
+	var b strings.Builder
+	for _, f := range result.Files {
+		d := f.Diagnostic
+		if d == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "### `%s` hunk #%d\n\nFailed hunk:\n```diff\n%s\n```\n\n", f.Path, f.Hunk, d.Hunk)
+		if d.Line == 0 {
+			b.WriteString("No similar region was found in the current file.\n\n")
+			continue
+		}
+		fmt.Fprintf(&b, "Current text at lines %d-%d:\n```\n%s\n```\n\n", d.Line, d.EndLine, strings.Join(d.Actual, "\n"))
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "Some edits from your previous response could not be applied because their context does not match the current files. " +
+		"Re-emit only these edits as diff blocks against the current text shown below.\n\n" + strings.TrimSpace(b.String())
 }
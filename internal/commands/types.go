@@ -13,6 +13,7 @@ type CommandOutput struct {
 }
 
 type SessionController interface {
+	GetID() string
 	GetMessages() []types.Message
 	GetConfig() *config.Config
 	SetTitle(title string)
@@ -24,6 +25,11 @@ type SessionController interface {
 	SetHasAppliedChanges(applied bool)
 	GetContextFiles() []string
 	SetContextFiles(files []string)
+	GetExplicitFiles() []string
+	SetExplicitFiles(paths []string)
+	GetContextHashes() map[string]string
+	RestoreSecrets(text string) string
+	SetRepairPrompt(prompt string)
 	GetMode() string
 	SetMode(mode string) error
 }
@@ -1,33 +1,56 @@
 package commands
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/pkg/itf"
-	"strings"
 )
 
 func init() {
-	registerCommand("undo", undoCmd, "undo last file changes", nil)
+	registerCommand("undo", undoCmd, "undo this session's last file changes, or those of message <n>", nil)
 }
 
 func undoCmd(args string, s SessionController) (CommandOutput, bool) {
+	msgIndex := -1
+	if arg := strings.TrimSpace(args); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return CommandOutput{Type: types.MessagesUpdated, Payload: fmt.Sprintf("Invalid message number: %s", arg)}, false
+		}
+		msgIndex = n - 1
+	}
+
+	summary, ok := UndoMessage(s, msgIndex)
+	return CommandOutput{Type: types.MessagesUpdated, Payload: summary}, ok
+}
+
+// UndoMessage reverts the itf changes this session applied for the message at
+// msgIndex, or its latest changes when msgIndex is negative. Changes made by
+// other sessions are left alone.
+func UndoMessage(s SessionController, msgIndex int) (string, bool) {
 	if !s.HasAppliedChanges() {
-		return CommandOutput{Type: types.MessagesUpdated, Payload: "No changes have been applied in this session to undo."}, false
+		return "No changes have been applied in this session to undo.", false
 	}
 
-	itfCfg := &itf.Config{Undo: true}
+	itfCfg := &itf.Config{Undo: true, SessionID: s.GetID(), MessageIndex: msgIndex}
 	app, err := itf.NewApp(itfCfg)
 	if err != nil {
-		return CommandOutput{Type: types.MessagesUpdated, Payload: "Failed to initialize itf: " + err.Error()}, false
+		return "Failed to initialize itf: " + err.Error(), false
 	}
 
 	summary, err := app.Execute()
 	if err != nil {
-		return CommandOutput{Type: types.MessagesUpdated, Payload: "Error undoing changes: " + err.Error()}, false
+		return "Error undoing changes: " + err.Error(), false
 	}
 
 	if summary.Message == "No undo" {
-		return CommandOutput{Type: types.MessagesUpdated, Payload: "No changes to undo."}, true
+		if msgIndex >= 0 {
+			return fmt.Sprintf("No changes from message %d to undo.", msgIndex+1), true
+		}
+		return "No changes to undo.", true
 	}
 
 	// Update context paths based on what was undone
@@ -73,5 +96,5 @@ func undoCmd(args string, s SessionController) (CommandOutput, bool) {
 		_ = s.LoadContext()
 	}
 
-	return CommandOutput{Type: types.MessagesUpdated, Payload: itf.FormatSummary(summary)}, true
+	return itf.FormatSummary(summary), true
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/sokinpui/coder/internal/utils"
 	"gopkg.in/yaml.v3"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -15,6 +16,28 @@ type Context struct {
 	Files      []string `mapstructure:"files"`
 	Dirs       []string `mapstructure:"dirs"`
 	Exclusions []string `mapstructure:"exclusions"`
+	// MaxTokens caps the project source sent to the model; 0 means no limit.
+	MaxTokens int `mapstructure:"maxtokens"`
+	// Format is the pcat format of the project source: markdown, xml or
+	// json. ModelFormats overrides it for models matching a glob.
+	Format       string        `mapstructure:"format"`
+	ModelFormats []ModelFormat `mapstructure:"modelformats"`
+}
+
+type ModelFormat struct {
+	Model  string `mapstructure:"model"`
+	Format string `mapstructure:"format"`
+}
+
+// FormatFor returns the source format for a model: the first matching
+// ModelFormats entry, or Format.
+func (c Context) FormatFor(model string) string {
+	for _, mf := range c.ModelFormats {
+		if ok, _ := path.Match(mf.Model, model); ok {
+			return mf.Format
+		}
+	}
+	return c.Format
 }
 
 type Clipboard struct {
@@ -33,6 +56,44 @@ type Generation struct {
 	ReasoningEffort string `mapstructure:"reasoningeffort"`
 }
 
+type Formatter struct {
+	Pattern string `mapstructure:"pattern"`
+	Command string `mapstructure:"command"`
+}
+
+type Itf struct {
+	Formatters  []Formatter `mapstructure:"formatters"`
+	Protected   []string    `mapstructure:"protected"`
+	StreamApply bool        `mapstructure:"streamapply"`
+	Checkpoints bool        `mapstructure:"checkpoints"`
+}
+
+type Verify struct {
+	Command       string `mapstructure:"command"`
+	AutoFix       bool   `mapstructure:"autofix"`
+	MaxIterations int    `mapstructure:"maxiterations"`
+}
+
+// Commit configures commit message generation. Template is the path of a
+// prompt file replacing the built-in one; {{DIFF}} is replaced by the diff.
+type Commit struct {
+	Template string `mapstructure:"template"`
+}
+
+// Redact configures secret redaction of everything sent to the model.
+// Patterns are added to the built-in rules; files matching a Deny glob are
+// never sent.
+type Redact struct {
+	Enabled  bool            `mapstructure:"enabled"`
+	Patterns []RedactPattern `mapstructure:"patterns"`
+	Deny     []string        `mapstructure:"deny"`
+}
+
+type RedactPattern struct {
+	Name  string `mapstructure:"name"`
+	Regex string `mapstructure:"regex"`
+}
+
 type UI struct {
 	MarkdownTheme string `mapstructure:"markdowntheme"`
 }
@@ -60,6 +121,7 @@ type Keymap struct {
 	Finder      string `mapstructure:"finder"`
 	ContextList string `mapstructure:"contextlist"`
 	ApplyITF    string `mapstructure:"applyitf"`
+	Repair      string `mapstructure:"repair"`
 	ScrollUp    string `mapstructure:"scrollup"`
 	ScrollDown  string `mapstructure:"scrolldown"`
 	Suspend     string `mapstructure:"suspend"`
@@ -73,9 +135,13 @@ type Config struct {
 	Generation      Generation `mapstructure:"generation"`
 	Context         Context    `mapstructure:"context"`
 	Clipboard       Clipboard  `mapstructure:"clipboard"`
+	Itf             Itf        `mapstructure:"itf"`
+	Verify          Verify     `mapstructure:"verify"`
+	Commit          Commit     `mapstructure:"commit"`
+	Redact          Redact     `mapstructure:"redact"`
 	UI              UI         `mapstructure:"ui"`
 	Keymap          Keymap     `mapstructure:"keymap"`
-	AvailableModels []string                `yaml:"-"`
+	AvailableModels []string   `yaml:"-"`
 }
 
 func DefaultConfig() Config {
@@ -89,14 +155,36 @@ func DefaultConfig() Config {
 			ReasoningEffort: "high",
 		},
 		Context: Context{
-			Dirs:       []string{"."},
-			Files:      []string{},
-			Exclusions: []string{},
+			Dirs:         []string{"."},
+			Files:        []string{},
+			Exclusions:   []string{},
+			MaxTokens:    0,
+			Format:       "markdown",
+			ModelFormats: []ModelFormat{},
 		},
 		Clipboard: Clipboard{
 			CopyCmd:  "",
 			PasteCmd: "",
 		},
+		Itf: Itf{
+			Formatters:  []Formatter{},
+			Protected:   []string{"go.sum", "vendor/**", "*.pem", "*.key", ".env"},
+			StreamApply: false,
+			Checkpoints: false,
+		},
+		Verify: Verify{
+			Command:       "",
+			AutoFix:       false,
+			MaxIterations: 3,
+		},
+		Commit: Commit{
+			Template: "",
+		},
+		Redact: Redact{
+			Enabled:  true,
+			Patterns: []RedactPattern{},
+			Deny:     []string{"*.pem", "*.key", "*.p12", "*.pfx", "*.keystore", ".env", ".env.*", "id_rsa", "id_ecdsa", "id_ed25519", ".netrc"},
+		},
 		UI: UI{
 			MarkdownTheme: "dark",
 		},
@@ -110,6 +198,7 @@ func DefaultConfig() Config {
 			Finder:      "ctrl+f",
 			ContextList: "ctrl+l",
 			ApplyITF:    "ctrl+a",
+			Repair:      "ctrl+r",
 			ScrollUp:    "ctrl+u",
 			ScrollDown:  "ctrl+d",
 			Suspend:     "ctrl+z",
@@ -208,6 +208,15 @@ func (g *Generator) GenerateTask(ctx context.Context, messages []types.Message,
 }
 
 func (g *Generator) GenerateTitle(ctx context.Context, prompt string) (string, error) {
+	return g.completeWithTitleModel(ctx, prompt, 256)
+}
+
+// GenerateCommitMessage asks the title model for a commit message.
+func (g *Generator) GenerateCommitMessage(ctx context.Context, prompt string) (string, error) {
+	return g.completeWithTitleModel(ctx, prompt, 1024)
+}
+
+func (g *Generator) completeWithTitleModel(ctx context.Context, prompt string, maxTokens int) (string, error) {
 	body := map[string]any{
 		"model":  g.Config.TitleModelCode,
 		"stream": false,
@@ -215,7 +224,7 @@ func (g *Generator) GenerateTitle(ctx context.Context, prompt string) (string, e
 			{Role: "user", Content: prompt},
 		},
 		"temperature": 1.0,
-		"max_tokens":  256,
+		"max_tokens":  maxTokens,
 	}
 
 	jsonBody, _ := json.Marshal(body)
@@ -246,7 +255,7 @@ func (g *Generator) GenerateTitle(ctx context.Context, prompt string) (string, e
 	}
 
 	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("empty choices in title generation")
+		return "", fmt.Errorf("empty choices in %s response", g.Config.TitleModelCode)
 	}
 
 	return strings.TrimSpace(openAIResp.Choices[0].Message.Content.(string)), nil
@@ -8,6 +8,9 @@ var CoderInstructions string
 //go:embed titleGenerate.md
 var TitleGenerationPrompt string
 
+//go:embed commitMessage.md
+var CommitMessagePrompt string
+
 const (
 	ProjectSourceCodeHeader   = "# PROJECT SOURCE CODE\n\n"
 	ConversationHistoryHeader = "# CONVERSATION HISTORY\n\n"
@@ -0,0 +1,226 @@
+// Package redact removes secrets from text before it is sent to a model.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sokinpui/coder/internal/config"
+)
+
+// Rule matches one kind of secret. When the pattern has a capture group,
+// only the first group is redacted.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// MinEntropy, when set, skips matches whose redacted part looks like
+	// ordinary text rather than a random secret.
+	MinEntropy float64
+}
+
+var builtinRules = []Rule{
+	{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY-----`)},
+	{Name: "aws-access-key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "github-token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Name: "anthropic-key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{Name: "openai-key", Pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{Name: "google-api-key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Name: "stripe-key", Pattern: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{
+		Name:       "secret-assignment",
+		Pattern:    regexp.MustCompile(`(?i)(?:secret|token|passw(?:or)?d|api[_-]?key|access[_-]?key|private[_-]?key)[A-Za-z0-9_]*["']?\s*[:=]\s*["']([^"'\s]{16,})["']`),
+		MinEntropy: 3.5,
+	},
+	{
+		Name:       "env-secret",
+		Pattern:    regexp.MustCompile(`(?m)^\s*(?:export\s+)?[A-Z0-9_]*(?:SECRET|TOKEN|PASSWORD|PASSWD|API_KEY|ACCESS_KEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*([^\s"'#]{8,})`),
+		MinEntropy: 3,
+	},
+	{
+		Name:       "high-entropy-string",
+		Pattern:    regexp.MustCompile(`["'` + "`" + `]([A-Za-z0-9+/=_-]{32,})["'` + "`" + `]`),
+		MinEntropy: 4.5,
+	},
+}
+
+// Finding is one redacted secret.
+type Finding struct {
+	Rule        string
+	Source      string
+	Placeholder string
+}
+
+// PlaceholderPattern matches the placeholders made by Placeholder.
+var PlaceholderPattern = regexp.MustCompile(`\[REDACTED:[^\]\s]+:[0-9a-f]{8}\]`)
+
+// Secrets maps placeholders back to the secrets they replaced, so that text
+// the model writes with placeholders can be restored before it reaches disk.
+// It is safe for concurrent use; a nil Secrets remembers nothing.
+type Secrets struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func NewSecrets() *Secrets {
+	return &Secrets{m: make(map[string]string)}
+}
+
+func (s *Secrets) add(placeholder, secret string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[placeholder] = secret
+}
+
+// Restore replaces the placeholders of known secrets in text with the
+// secrets. Unknown placeholders are left as they are.
+func (s *Secrets) Restore(text string) string {
+	if s == nil || !strings.Contains(text, "[REDACTED:") {
+		return text
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return PlaceholderPattern.ReplaceAllStringFunc(text, func(p string) string {
+		if secret, ok := s.m[p]; ok {
+			return secret
+		}
+		return p
+	})
+}
+
+type Redactor struct {
+	rules   []Rule
+	deny    []string
+	secrets *Secrets
+}
+
+// New builds a redactor from the built-in rules and the configured patterns.
+// The secrets it redacts are recorded in secrets, which may be nil.
+// Invalid patterns are skipped and reported in the returned error, together
+// with a usable redactor.
+func New(cfg config.Redact, secrets *Secrets) (*Redactor, error) {
+	r := &Redactor{rules: append([]Rule{}, builtinRules...), deny: cfg.Deny, secrets: secrets}
+
+	var errs []error
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid redact pattern %q: %w", p.Name, err))
+			continue
+		}
+		name := p.Name
+		if name == "" {
+			name = "custom"
+		}
+		r.rules = append(r.rules, Rule{Name: name, Pattern: re})
+	}
+	return r, errors.Join(errs...)
+}
+
+// Redact replaces every secret in text with a placeholder derived from the
+// secret, so the same secret always gets the same placeholder. Source names
+// the text in the findings.
+func (r *Redactor) Redact(text, source string) (string, []Finding) {
+	var findings []Finding
+	for _, rule := range r.rules {
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			secret := match
+			if rule.Pattern.NumSubexp() > 0 {
+				sub := rule.Pattern.FindStringSubmatch(match)
+				if len(sub) < 2 || sub[1] == "" {
+					return match
+				}
+				secret = sub[1]
+			}
+			if isPlaceholder(secret) || (rule.MinEntropy > 0 && entropy(secret) < rule.MinEntropy) {
+				return match
+			}
+
+			placeholder := Placeholder(rule.Name, secret)
+			r.secrets.add(placeholder, secret)
+			findings = append(findings, Finding{Rule: rule.Name, Source: source, Placeholder: placeholder})
+			return strings.Replace(match, secret, placeholder, 1)
+		})
+	}
+	return text, findings
+}
+
+// Denied reports whether a file may not be sent at all. Patterns without a
+// slash match the file name; others match the slash-separated path.
+func (r *Redactor) Denied(file string) bool {
+	file = filepath.ToSlash(file)
+	for _, pattern := range r.deny {
+		target := file
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(file)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func Placeholder(rule, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return fmt.Sprintf("[REDACTED:%s:%s]", rule, hex.EncodeToString(sum[:4]))
+}
+
+func isPlaceholder(s string) bool {
+	return strings.HasPrefix(s, "[REDACTED:")
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	var e float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// Summary describes findings and refused files for the user, e.g.
+// "Redacted 2 secrets (aws-access-key in project source, jwt in shell output)".
+func Summary(findings []Finding, refused []string) string {
+	var parts []string
+	if len(findings) > 0 {
+		seen := make(map[string]struct{})
+		var kinds []string
+		for _, f := range findings {
+			kind := fmt.Sprintf("%s in %s", f.Rule, f.Source)
+			if _, ok := seen[kind]; !ok {
+				seen[kind] = struct{}{}
+				kinds = append(kinds, kind)
+			}
+		}
+		sort.Strings(kinds)
+		noun := "secrets"
+		if len(findings) == 1 {
+			noun = "secret"
+		}
+		parts = append(parts, fmt.Sprintf("Redacted %d %s before sending (%s).", len(findings), noun, strings.Join(kinds, ", ")))
+	}
+	if len(refused) > 0 {
+		parts = append(parts, fmt.Sprintf("Refused to send %s (matches redact.deny).", strings.Join(refused, ", ")))
+	}
+	return strings.Join(parts, "\n")
+}
@@ -3,32 +3,127 @@ package session
 import (
 	"fmt"
 	"github.com/sokinpui/coder/internal/prompt"
+	"github.com/sokinpui/coder/internal/redact"
 	"github.com/sokinpui/coder/internal/source"
+	"github.com/sokinpui/coder/internal/token"
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/internal/utils"
+	"github.com/sokinpui/coder/pkg/itf"
+	"github.com/sokinpui/coder/pkg/pcat"
+	"path/filepath"
+	"slices"
 )
 
+// LoadContext reads the context files into the project source of the
+// prompt. Calls are serialized, since the initial load runs in the
+// background while commands may reload the context.
 func (s *Session) LoadContext() error {
-	if len(s.contextFiles) == 0 {
-		s.projectSourceCode = ""
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.contextMu.Lock()
+	contextFiles, explicitFiles := s.contextFiles, s.explicitFiles
+	s.contextMu.Unlock()
+
+	files, refused := s.allowedContextFiles(contextFiles)
+	if len(files) == 0 {
+		s.setLoadedContext("", 0, nil, refused)
 		return nil
 	}
 
-	projSource, err := source.LoadProjectSource(s.contextFiles)
+	var explicit, listed []string
+	for _, f := range files {
+		if _, ok := explicitFiles[pcat.ParseSelector(f).Path]; ok {
+			explicit = append(explicit, f)
+		} else {
+			listed = append(listed, f)
+		}
+	}
+
+	ctx := s.config.Context
+	projSource, err := source.LoadProjectSource(explicit, listed, ctx.MaxTokens, ctx.FormatFor(s.config.Generation.ModelCode), s.sourceCache)
 	if err != nil {
 		return fmt.Errorf("failed to load project source: %w", err)
 	}
 
 	if projSource == "" {
-		s.projectSourceCode = ""
+		s.setLoadedContext("", 0, nil, refused)
 		return nil
 	}
-	s.projectSourceCode = prompt.ProjectSourceCodeHeader + projSource
+	redacted, findings := s.redactSource(projSource)
+	code := prompt.ProjectSourceCodeHeader + redacted
+
+	// The cache has counted every file, so only redacted source, whose
+	// placeholders change the count, is counted again.
+	tokens := token.Count(prompt.ProjectSourceCodeHeader) + s.sourceCache.Tokens()
+	if len(findings) > 0 {
+		tokens = token.Count(code)
+	}
+	s.setLoadedContext(code, tokens, findings, refused)
 	return nil
 }
 
+func (s *Session) setLoadedContext(code string, tokens int, findings []redact.Finding, refused []string) {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+	s.projectSourceCode, s.sourceTokens = code, tokens
+	s.redaction.sourceFindings, s.redaction.refusedFiles = findings, refused
+}
+
+func (s *Session) loadedContext() (code string, tokens int) {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+	return s.projectSourceCode, s.sourceTokens
+}
+
+// PromptTokens returns the token count of the prompt for the current
+// conversation, using the count of the project source from LoadContext.
+func (s *Session) PromptTokens() int {
+	_, sourceTokens := s.loadedContext()
+	msgs, _ := s.buildPrompt(s.messages)
+
+	total := 0
+	for _, msg := range msgs {
+		if msg.Type == types.SourceCodeMessage {
+			total += sourceTokens
+			continue
+		}
+		total += token.CountTokens([]types.Message{msg})
+	}
+	return total
+}
+
+func (s *Session) snapshotContext() {
+	s.contextMu.Lock()
+	contextFiles := slices.Clone(s.contextFiles)
+	s.contextMu.Unlock()
+
+	hashes := make(map[string]string, len(contextFiles))
+	for _, f := range contextFiles {
+		abs, err := filepath.Abs(pcat.ParseSelector(f).Path)
+		if err != nil {
+			continue
+		}
+		if h, err := itf.GetFileSHA256(abs); err == nil {
+			hashes[abs] = h
+		}
+	}
+	s.contextHashes = hashes
+}
+
+// BuildPrompt returns the prompt for messages and records what it redacted
+// for RedactionReport.
 func (s *Session) BuildPrompt(messages []types.Message) []types.Message {
+	result, findings := s.buildPrompt(messages)
+	s.contextMu.Lock()
+	s.redaction.promptFindings = findings
+	s.contextMu.Unlock()
+	return result
+}
+
+func (s *Session) buildPrompt(messages []types.Message) ([]types.Message, []redact.Finding) {
 	var result []types.Message
+	projectSourceCode, _ := s.loadedContext()
 
 	switch s.mode {
 	case ModeCoding:
@@ -40,22 +135,29 @@ func (s *Session) BuildPrompt(messages []types.Message) []types.Message {
 		if dirInfo := utils.GetDirInfoContent(); dirInfo != "" {
 			result = append(result, types.Message{Type: types.DirectoryMessage, Content: dirInfo})
 		}
-		if s.projectSourceCode != "" {
-			result = append(result, types.Message{Type: types.SourceCodeMessage, Content: s.projectSourceCode})
+		if projectSourceCode != "" {
+			result = append(result, types.Message{Type: types.SourceCodeMessage, Content: projectSourceCode})
 		}
 	case ModeChat:
-		if s.projectSourceCode != "" {
-			result = append(result, types.Message{Type: types.SourceCodeMessage, Content: s.projectSourceCode})
+		if projectSourceCode != "" {
+			result = append(result, types.Message{Type: types.SourceCodeMessage, Content: projectSourceCode})
 		}
 	default:
 	}
 
+	var findings []redact.Finding
+	used := make(map[messageKey]redactedMessage)
 	for _, msg := range messages {
 		if !msg.CanSendToAI() {
 			continue
 		}
+		msg, f := s.redactMessage(msg, used)
 		result = append(result, msg)
+		findings = append(findings, f...)
 	}
 
-	return result
+	s.contextMu.Lock()
+	s.redaction.messages = used
+	s.contextMu.Unlock()
+	return result, findings
 }
@@ -33,8 +33,10 @@ func (s *Session) StartGeneration() types.Event {
 		})
 		return types.Event{Type: types.MessagesUpdated}
 	}
+	s.snapshotContext()
 
 	messages := s.GetPrompt()
+	s.reportRedactions()
 	repoRoot := utils.GetProjectRoot()
 
 	for i := range messages {
@@ -36,7 +36,7 @@ func (s *Session) SaveConversation() error {
 		wd = ""
 	}
 
-	promptMsgs := s.BuildPrompt(nil)
+	promptMsgs, _ := s.buildPrompt(nil)
 	allMsgs := append([]types.Message{}, promptMsgs...)
 	allMsgs = append(allMsgs, s.messages...)
 
@@ -134,3 +134,40 @@ func (s *Session) RegenerateFrom(messageIndex int) types.Event {
 	s.messages = s.messages[:messageIndex+1]
 	return s.StartGeneration()
 }
+
+// RegenerateLast regenerates the latest AI response from the message that
+// prompted it, so the model sees the current content of the context files.
+func (s *Session) RegenerateLast() types.Event {
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if !s.messages[i].Type.IsAI() {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if s.messages[j].Type.IsRegeneratable() {
+				return s.RegenerateFrom(j)
+			}
+		}
+		break
+	}
+
+	s.messages = append(s.messages, types.Message{
+		Type:    types.CommandErrorResultMessage,
+		Content: "No AI response found to regenerate.",
+	})
+	return types.Event{Type: types.MessagesUpdated}
+}
+
+// Repair asks the model to re-emit the hunks that failed in the last apply.
+func (s *Session) Repair() types.Event {
+	if s.repairPrompt == "" {
+		s.messages = append(s.messages, types.Message{
+			Type:    types.CommandErrorResultMessage,
+			Content: "No failed hunks to repair.",
+		})
+		return types.Event{Type: types.MessagesUpdated}
+	}
+
+	s.messages = append(s.messages, types.Message{Type: types.UserMessage, Content: s.repairPrompt})
+	s.repairPrompt = ""
+	return s.StartGeneration()
+}
@@ -35,7 +35,7 @@ func (s *Session) processInput(input string, silent bool) types.Event {
 			return types.Event{Type: cmdOutput.Type, Mode: cmdOutput.Mode}
 		case types.NoOp:
 			return types.Event{Type: types.NoOp}
-		case types.MessagesUpdated:
+		case types.MessagesUpdated, types.ItfApplied:
 			// Fall through to standard logging below
 		default:
 			// Mode transition events: log the command call then return transition event.
@@ -65,6 +65,9 @@ func (s *Session) processInput(input string, silent bool) types.Event {
 			msgType = types.ShellCmdResultMessage
 		}
 		s.messages = append(s.messages, types.Message{Type: msgType, Content: cmdOutput.Payload})
+		if cmdOutput.Type == types.ItfApplied {
+			return types.Event{Type: types.ItfApplied}
+		}
 	} else {
 		s.messages = append(s.messages, types.Message{Type: types.CommandErrorResultMessage, Content: cmdOutput.Payload})
 	}
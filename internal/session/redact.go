@@ -0,0 +1,164 @@
+package session
+
+import (
+	"log"
+
+	"github.com/sokinpui/coder/internal/redact"
+	"github.com/sokinpui/coder/internal/types"
+)
+
+// redactionState holds what the last prompt had redacted, for reporting.
+type redactionState struct {
+	redactor *redact.Redactor
+	// secrets outlives the redactor across config reloads, so placeholders
+	// already sent can still be restored.
+	secrets        *redact.Secrets
+	sourceFindings []redact.Finding
+	promptFindings []redact.Finding
+	refusedFiles   []string
+	lastReport     string
+	// rawSource, redactedSource and rawFindings skip redacting unchanged
+	// source again; messages does the same for the messages of the last
+	// prompt.
+	rawSource      string
+	redactedSource string
+	rawFindings    []redact.Finding
+	messages       map[messageKey]redactedMessage
+}
+
+type messageKey struct {
+	msgType types.MessageType
+	content string
+}
+
+type redactedMessage struct {
+	content  string
+	findings []redact.Finding
+}
+
+// resetRedactor builds the redactor from the current config. It is nil when
+// redaction is disabled.
+func (s *Session) resetRedactor() {
+	s.redaction.redactor = nil
+	s.redaction.rawSource, s.redaction.redactedSource, s.redaction.rawFindings = "", "", nil
+	s.contextMu.Lock()
+	s.redaction.messages = nil
+	s.contextMu.Unlock()
+	if !s.config.Redact.Enabled {
+		return
+	}
+	if s.redaction.secrets == nil {
+		s.redaction.secrets = redact.NewSecrets()
+	}
+	r, err := redact.New(s.config.Redact, s.redaction.secrets)
+	if err != nil {
+		log.Printf("Redaction: %v", err)
+	}
+	s.redaction.redactor = r
+}
+
+// RestoreSecrets puts back the secrets behind the placeholders this session
+// sent to the model, so that code written with them does not overwrite the
+// real values.
+func (s *Session) RestoreSecrets(text string) string {
+	return s.redaction.secrets.Restore(text)
+}
+
+func (s *Session) getRedactor() *redact.Redactor {
+	return s.redaction.redactor
+}
+
+// allowedContextFiles drops the files on the deny-list and returns them as
+// refused.
+func (s *Session) allowedContextFiles(files []string) (allowed, refused []string) {
+	r := s.getRedactor()
+	if r == nil {
+		return files, nil
+	}
+
+	for _, f := range files {
+		if r.Denied(f) {
+			refused = append(refused, f)
+			continue
+		}
+		allowed = append(allowed, f)
+	}
+	return allowed, refused
+}
+
+// redactSource redacts the project source. It is only called by
+// LoadContext, which holds loadMu.
+func (s *Session) redactSource(text string) (string, []redact.Finding) {
+	r := s.getRedactor()
+	if r == nil {
+		return text, nil
+	}
+	if text != s.redaction.rawSource {
+		s.redaction.rawSource = text
+		s.redaction.redactedSource, s.redaction.rawFindings = r.Redact(text, "project source")
+	}
+	return s.redaction.redactedSource, s.redaction.rawFindings
+}
+
+// redactMessage redacts the user-supplied text of a prompt message: user
+// input and shell commands and their output. Messages redacted for the last
+// prompt are reused; the redaction is recorded in used.
+func (s *Session) redactMessage(msg types.Message, used map[messageKey]redactedMessage) (types.Message, []redact.Finding) {
+	r := s.getRedactor()
+	if r == nil {
+		return msg, nil
+	}
+
+	var source string
+	switch msg.Type {
+	case types.UserMessage:
+		source = "user message"
+	case types.ShellCmdMessage:
+		source = "shell command"
+	case types.ShellCmdResultMessage:
+		source = "shell output"
+	default:
+		return msg, nil
+	}
+
+	key := messageKey{msgType: msg.Type, content: msg.Content}
+	s.contextMu.Lock()
+	red, ok := s.redaction.messages[key]
+	s.contextMu.Unlock()
+	if !ok {
+		red.content, red.findings = r.Redact(msg.Content, source)
+	}
+	used[key] = red
+	msg.Content = red.content
+	return msg, red.findings
+}
+
+// RedactionReport describes what the last prompt had redacted or refused.
+func (s *Session) RedactionReport() string {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+	findings := append(append([]redact.Finding{}, s.redaction.sourceFindings...), s.redaction.promptFindings...)
+	return redact.Summary(findings, s.redaction.refusedFiles)
+}
+
+// reportRedactions adds the redaction report to the conversation when it
+// changed since it was last shown.
+func (s *Session) reportRedactions() {
+	report := s.RedactionReport()
+	if report == "" || report == s.redaction.lastReport {
+		return
+	}
+	s.redaction.lastReport = report
+	s.AddMessages(types.Message{Type: types.CommandResultMessage, Content: report})
+}
+
+// RedactText redacts text sent outside the conversation, such as the prompt
+// used to generate the title.
+func (s *Session) RedactText(text string) string {
+	r := s.getRedactor()
+	if r == nil {
+		return text
+	}
+	text, _ = r.Redact(text, "")
+	return text
+}
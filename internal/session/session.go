@@ -9,8 +9,11 @@ import (
 	"github.com/sokinpui/coder/internal/source"
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/internal/utils"
+	"github.com/sokinpui/coder/pkg/pcat"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -33,9 +36,22 @@ type Session struct {
 	mode              string
 	instruction       string
 	projectSourceCode string
+	sourceCache       *pcat.Cache
+	sourceTokens      int
 	lastModifiedFiles []string
 	hasAppliedChanges bool
 	contextFiles      []string
+	explicitFiles     map[string]struct{}
+	contextHashes     map[string]string
+	repairPrompt      string
+	redaction         redactionState
+
+	// loadMu serializes LoadContext, whose runs share sourceCache, and
+	// config reloads. contextMu guards the context files and what
+	// LoadContext loaded from them, which the initial load sets from a
+	// goroutine.
+	loadMu    sync.Mutex
+	contextMu sync.Mutex
 }
 
 func New(cfg *config.Config, mode string, instruction string, contextFiles []string) (*Session, error) {
@@ -70,7 +86,7 @@ func NewWithMessages(cfg *config.Config, initialMessages []types.Message, mode s
 	allExclusions := append([]string{}, source.Exclusions...)
 	allExclusions = append(allExclusions, cfgCopy.Context.Exclusions...)
 
-	var resolvedContextFiles []string
+	var resolvedContextFiles, explicitFiles []string
 	switch mode {
 	case ModeCoding:
 		var dirs, files []string
@@ -90,6 +106,7 @@ func NewWithMessages(cfg *config.Config, initialMessages []types.Message, mode s
 		}
 
 		resolvedContextFiles, _ = utils.SourceToFileList(dirs, files, allExclusions)
+		explicitFiles = files
 	default:
 		// Other modes do not load context files by default
 	}
@@ -107,7 +124,10 @@ func NewWithMessages(cfg *config.Config, initialMessages []types.Message, mode s
 		mode:            mode,
 		instruction:     instruction,
 		contextFiles:    resolvedContextFiles,
+		sourceCache:     pcat.NewCache(),
 	}
+	s.SetExplicitFiles(explicitFiles)
+	s.resetRedactor()
 
 	return s, nil
 }
@@ -121,7 +141,10 @@ func (s *Session) ReloadConfig() error {
 	if err != nil {
 		return err
 	}
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
 	s.config = cfg
+	s.resetRedactor()
 	s.generator.Config = cfg.Generation
 	s.generator.BaseURL = cfg.Server.URL
 	s.generator.APIKey = cfg.Server.APIKey
@@ -145,11 +168,63 @@ func (s *Session) GetInstruction() string {
 }
 
 func (s *Session) GetContextFiles() []string {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
 	return s.contextFiles
 }
 
 func (s *Session) SetContextFiles(files []string) {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
 	s.contextFiles = files
+
+	kept := make(map[string]struct{}, len(s.explicitFiles))
+	for _, f := range files {
+		path := pcat.ParseSelector(f).Path
+		if _, ok := s.explicitFiles[path]; ok {
+			kept[path] = struct{}{}
+		}
+	}
+	s.explicitFiles = kept
+}
+
+// GetExplicitFiles returns the paths of the context files that were named
+// explicitly rather than listed from a directory.
+func (s *Session) GetExplicitFiles() []string {
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+	paths := make([]string, 0, len(s.explicitFiles))
+	for path := range s.explicitFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// SetExplicitFiles marks the context files with the given paths as named
+// explicitly, so that they are kept first when the context is packed.
+func (s *Session) SetExplicitFiles(paths []string) {
+	explicit := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		explicit[pcat.ParseSelector(filepath.ToSlash(p)).Path] = struct{}{}
+	}
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+	s.explicitFiles = explicit
+}
+
+// GetContextHashes returns the SHA-256 of each context file as it was when the
+// last prompt was built.
+func (s *Session) GetContextHashes() map[string]string {
+	return s.contextHashes
+}
+
+func (s *Session) GetRepairPrompt() string {
+	return s.repairPrompt
+}
+
+func (s *Session) SetRepairPrompt(prompt string) {
+	s.repairPrompt = prompt
 }
 
 func (s *Session) GetLastModifiedFiles() []string {
@@ -160,6 +235,10 @@ func (s *Session) SetLastModifiedFiles(files []string) {
 	s.lastModifiedFiles = files
 }
 
+func (s *Session) GetID() string {
+	return s.ID
+}
+
 func (s *Session) HasAppliedChanges() bool {
 	return s.hasAppliedChanges
 }
@@ -2,25 +2,29 @@ package source
 
 import (
 	"fmt"
+	"github.com/sokinpui/coder/internal/token"
 	"github.com/sokinpui/coder/pkg/pcat"
 )
 
 // LoadProjectSource executes `fd` and pipes it to `pcat` to get formatted source code
-// of files in the current directory, respecting .gitignore.
-func LoadProjectSource(files []string) (string, error) {
-	if len(files) == 0 {
+// of files in the current directory, respecting .gitignore. A positive
+// maxTokens packs the files within that budget, keeping the explicitly named
+// files ahead of those listed from directories; format is a pcat format.
+// A non-nil cache avoids re-reading unchanged files.
+func LoadProjectSource(explicit, listed []string, maxTokens int, format string, cache *pcat.Cache) (string, error) {
+	if len(explicit) == 0 && len(listed) == 0 {
 		return "", nil
 	}
 
-	output, err := pcat.Run(
-		files, // specificFiles
-		nil,   // directories
-		nil,   // extensions
-		nil,   // excludePatterns
-		false, // withLineNumbers
-		true,  // hidden
-		false, // listOnly
-	)
+	output, err := pcat.RunWithOptions(pcat.Options{
+		SpecificFiles: explicit,
+		ListedFiles:   listed,
+		Hidden:        true,
+		MaxTokens:     maxTokens,
+		CountTokens:   token.Count,
+		Format:        format,
+		Cache:         cache,
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to load project source with pcat: %w", err)
 	}
@@ -24,7 +24,6 @@ func getEncoder() tokenizer.Codec {
 }
 
 func CountTokens(messages []types.Message) int {
-	encoder := getEncoder()
 	total := 0
 
 	for _, msg := range messages {
@@ -36,21 +35,25 @@ func CountTokens(messages []types.Message) int {
 			continue
 		}
 
-		if encoder != nil {
-			ids, _, err := encoder.Encode(msg.Content)
-			if err == nil {
-				total += len(ids)
-				continue
-			}
-		}
-
-		// Fallback heuristic if encoder fails
-		total += estimateTokensFallback(msg.Content)
+		total += Count(msg.Content)
 	}
 
 	return total
 }
 
+// Count returns the number of tokens in text.
+func Count(text string) int {
+	if encoder := getEncoder(); encoder != nil {
+		ids, _, err := encoder.Encode(text)
+		if err == nil {
+			return len(ids)
+		}
+	}
+
+	// Fallback heuristic if encoder fails
+	return estimateTokensFallback(text)
+}
+
 func estimateTokensFallback(text string) int {
 	// Simple fallback: ~4 characters per token average
 	return len(text) / 4
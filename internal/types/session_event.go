@@ -19,6 +19,10 @@ const (
 	ListViewerStarted
 	FileViewerStarted
 	TermExecutionStarted
+	RegenerateStarted
+	ItfApplied
+	RepairStarted
+	CommitStarted
 	Quit
 )
 
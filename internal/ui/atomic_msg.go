@@ -102,7 +102,7 @@ func (m AtomicMsgModel) View(messages []types.Message, maxHeight int) string {
 		msgLines = append(msgLines, m.renderMsgItem(msg, idx, idx == m.Cursor, isSelected, itemWidth))
 	}
 
-	header := paletteHeaderStyle.Render("── Atomic Messages [Esc/C-c: exit | v: select | o: swap | y/d: copy/del | a/e/r/b] ──")
+	header := paletteHeaderStyle.Render("── Atomic Messages [Esc/C-c: exit | v: select | o: swap | y/d: copy/del | a/u/e/r/b] ──")
 	body := strings.Join(msgLines, "\n")
 	content := lipgloss.JoinVertical(lipgloss.Left, header, body)
 	return paletteContainerStyle.Width(m.Width).Render(content)
@@ -242,21 +242,15 @@ func (m Model) handleKeyPressAtomicMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool
 	case "a":
 		m.AtomicMsg.IsSelecting = false
 		messages := m.Session.GetMessages()
-		targetMsg := messages[currIdx]
-		var aiResponseToApply string
-
-		if targetMsg.Type == types.AIMessage && targetMsg.Content != "" {
-			aiResponseToApply = targetMsg.Content
-		} else {
-			for i := currIdx; i >= 0; i-- {
-				if messages[i].Type == types.AIMessage && messages[i].Content != "" {
-					aiResponseToApply = messages[i].Content
-					break
-				}
+		aiIndex := -1
+		for i := currIdx; i >= 0; i-- {
+			if messages[i].Type == types.AIMessage && messages[i].Content != "" {
+				aiIndex = i
+				break
 			}
 		}
 
-		if aiResponseToApply == "" {
+		if aiIndex < 0 {
 			m.StatusBarMessage = "No AI response found to apply."
 			m.ActiveOverlay = overlayNone
 			if m.State == stateIdle {
@@ -265,8 +259,10 @@ func (m Model) handleKeyPressAtomicMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool
 			return m, tea.Batch(clearStatusBarCmd(), textarea.Blink), true
 		}
 
-		res := commands.ExecuteItf(aiResponseToApply, "")
+		base := commands.CheckpointBase(m.Session)
+		res := commands.ExecuteItf(messages[aiIndex].Content, "", commands.NewSessionItfConfig(m.Session, aiIndex))
 		m.Session.SetLastModifiedFiles(res.AffectedFiles)
+		m.Session.SetRepairPrompt(commands.BuildRepairPrompt(res.Result))
 		m.Session.AddMessages(types.Message{Type: types.CommandMessage, Content: "/itf"})
 
 		if res.Success {
@@ -275,6 +271,39 @@ func (m Model) handleKeyPressAtomicMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool
 			m.Session.AddMessages(types.Message{Type: types.CommandErrorResultMessage, Content: res.Summary})
 		}
 
+		m.ActiveOverlay = overlayNone
+		if m.State == stateIdle {
+			m.Chat.TextArea.Focus()
+		}
+		m.Chat.Viewport.SetContent(m.renderConversation())
+		m.Chat.Viewport.GotoBottom()
+		if res.Success && res.HasChanges() {
+			m.Session.SetHasAppliedChanges(true)
+			commands.SaveCheckpoint(res, m.Session, base)
+			model, verify := m.startVerify()
+			return model, tea.Batch(textarea.Blink, verify), true
+		}
+		return m, textarea.Blink, true
+
+	case "u":
+		m.AtomicMsg.IsSelecting = false
+		if m.Session.GetMessages()[currIdx].Type != types.AIMessage {
+			m.StatusBarMessage = "Only changes from AI messages can be undone."
+			m.ActiveOverlay = overlayNone
+			if m.State == stateIdle {
+				m.Chat.TextArea.Focus()
+			}
+			return m, tea.Batch(clearStatusBarCmd(), textarea.Blink), true
+		}
+
+		summary, ok := commands.UndoMessage(m.Session, currIdx)
+		m.Session.AddMessages(types.Message{Type: types.CommandMessage, Content: fmt.Sprintf("/undo %d", currIdx+1)})
+		if ok {
+			m.Session.AddMessages(types.Message{Type: types.CommandResultMessage, Content: summary})
+		} else {
+			m.Session.AddMessages(types.Message{Type: types.CommandErrorResultMessage, Content: summary})
+		}
+
 		m.ActiveOverlay = overlayNone
 		if m.State == stateIdle {
 			m.Chat.TextArea.Focus()
@@ -4,6 +4,7 @@ import (
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/sokinpui/coder/internal/commands"
 	"github.com/sokinpui/coder/internal/types"
 	"time"
 )
@@ -38,6 +39,11 @@ type ChatModel struct {
 	RenderCache              map[int]cachedRender
 	StateStartTime           time.Time
 	AutoSubmitPending        bool
+	IsVerifying              bool
+	VerifyIteration          int
+	VerifyFixPending         bool
+	StreamApplier            *commands.StreamItf
+	StreamApplyLog           []string
 }
 
 func NewChat(initialInput string) ChatModel {
@@ -40,6 +40,12 @@ func (m Model) renderConversationWithOffsets() (string, map[int]int) {
 		currentLine += len(lines)
 	}
 
+	if m.Chat.IsStreaming && len(m.Chat.StreamApplyLog) > 0 {
+		applyLog := "Applying:\n" + strings.Join(m.Chat.StreamApplyLog, "\n")
+		rendered := commandResultStyle.Width(viewportWidth - commandResultStyle.GetHorizontalFrameSize()).Render(applyLog)
+		allLines = append(allLines, strings.Split(rendered, "\n")...)
+	}
+
 	if m.State == stateAsking || m.State == stateThinking {
 		thinkingLine := m.renderThinkingLine()
 		allLines = append(allLines, strings.Split(thinkingLine, "\n")...)
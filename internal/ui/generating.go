@@ -3,6 +3,7 @@ package ui
 import (
 	"time"
 
+	"github.com/sokinpui/coder/internal/commands"
 	"github.com/sokinpui/coder/internal/types"
 
 	"github.com/charmbracelet/bubbles/textarea"
@@ -13,6 +14,9 @@ func (m Model) startGeneration(event types.Event) (Model, tea.Cmd) {
 	if event.Type != types.GenerationStarted {
 		return m, nil // Should not happen
 	}
+	m, _ = m.finishStreamApply()
+	m.Chat.StreamApplier = commands.NewStreamItf(m.Session)
+
 	m.State = stateAsking
 	m.Chat.StateStartTime = time.Now()
 	m.Chat.IsStreaming = true
@@ -30,6 +30,19 @@ func (m Model) handleEvent(event types.Event) (tea.Model, tea.Cmd) {
 	case types.GenerationStarted:
 		return m.startGeneration(event)
 
+	case types.ItfApplied:
+		m.Chat.Viewport.SetContent(m.renderConversation())
+		m.Chat.Viewport.GotoBottom()
+		m = m.updateLayout()
+		m.UpdateTokenCount()
+		return m.startVerify()
+
+	case types.RepairStarted:
+		return m.handleEvent(m.Session.Repair())
+
+	case types.RegenerateStarted:
+		return m.handleEvent(m.Session.RegenerateLast())
+
 	case types.AtomicMsgModeStarted,
 		types.GenerateModeStarted,
 		types.EditModeStarted,
@@ -103,6 +116,13 @@ func (m Model) handleEvent(event types.Event) (tea.Model, tea.Cmd) {
 		m.Chat.TextArea.Blur()
 		return m, execTerminalCmd(cmdStr)
 
+	case types.CommitStarted:
+		m.ActiveOverlay = overlayNone
+		m.StatusBarMessage = "Generating commit message..."
+		m.Chat.Viewport.SetContent(m.renderConversation())
+		m.Chat.Viewport.GotoBottom()
+		return m, prepareCommitCmd(m.Session.GetConfig())
+
 	case types.Quit:
 		m.Quitting = true
 		return m, tea.Quit
@@ -125,6 +145,7 @@ func (m Model) newSession(mode string) (Model, tea.Cmd) {
 		return m, nil
 	}
 
+	newSess.SetExplicitFiles(m.Session.GetExplicitFiles())
 	m.Session = newSess
 	m.ClearCache()
 	m.addActiveSession(newSess)
@@ -375,6 +396,11 @@ func (m Model) handleKeyPressIdle(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
 		model, cmd := m.handleEvent(event)
 		return model, cmd, true
 
+	case km.Repair:
+		event := m.Session.HandleInput("/repair")
+		model, cmd := m.handleEvent(event)
+		return model, cmd, true
+
 	case km.Paste:
 		return m, handlePasteCmd(m.Session.GetConfig()), true
 	}
@@ -113,6 +113,7 @@ func (m Model) handleMessage(msg tea.Msg) (tea.Model, tea.Cmd, bool) {
 			} else {
 				m.Session.AddMessages(types.Message{Type: types.AIMessage, Content: msg.Content})
 			}
+			m = m.feedStreamApply(msg.Content)
 
 			wasAtBottom := m.Chat.Viewport.AtBottom()
 			m.Chat.Viewport.SetContent(m.renderConversation())
@@ -148,6 +149,11 @@ func (m Model) handleMessage(msg tea.Msg) (tea.Model, tea.Cmd, bool) {
 			m.Chat.LastInteractionFailed = true
 		}
 
+		// Changes written during the stream are recorded even when cancelled.
+		streaming := m.Chat.StreamApplier != nil
+		var streamApplied bool
+		m, streamApplied = m.finishStreamApply()
+
 		m.State = stateIdle
 		if m.ActiveOverlay == overlayNone {
 			m.Chat.TextArea.Focus()
@@ -163,12 +169,38 @@ func (m Model) handleMessage(msg tea.Msg) (tea.Model, tea.Cmd, bool) {
 		m.Chat.TextArea.Reset()
 		m = m.updateLayout()
 
+		applyFix := m.Chat.VerifyFixPending
+		m.Chat.VerifyFixPending = false
+
 		if m.Chat.LastInteractionFailed {
+			m.Chat.VerifyIteration = 0
 			return m, nil, true // Don't count tokens on failure/cancellation
 		}
 		m.UpdateTokenCount()
 
-		return m, tea.Batch(saveConversationCmd(m.Session), m.Chat.Spinner.Tick), true
+		cmds := []tea.Cmd{saveConversationCmd(m.Session), m.Chat.Spinner.Tick}
+		if streaming {
+			if streamApplied {
+				var verify tea.Cmd
+				m, verify = m.startVerify()
+				cmds = append(cmds, verify)
+			} else {
+				m.Chat.VerifyIteration = 0
+			}
+		} else if applyFix {
+			event := m.Session.HandleInput("/itf")
+			if event.Type != types.ItfApplied {
+				m.Chat.VerifyIteration = 0
+			}
+			model, cmd := m.handleEvent(event)
+			m = model.(Model)
+			cmds = append(cmds, cmd)
+		}
+		return m, tea.Batch(cmds...), true
+
+	case verifyFinishedMsg:
+		model, cmd := m.handleVerifyFinished(msg)
+		return model, cmd, true
 
 	case editorFinishedMsg:
 		if msg.err != nil {
@@ -422,6 +454,17 @@ func (m Model) handleMessage(msg tea.Msg) (tea.Model, tea.Cmd, bool) {
 		m.UpdateTokenCount()
 		return m, nil, true
 
+	case commitPreparedMsg:
+		m.StatusBarMessage = ""
+		if msg.err != nil {
+			m.Session.AddMessages(types.Message{Type: types.CommandErrorResultMessage, Content: msg.err.Error()})
+			m.Chat.Viewport.SetContent(m.renderConversation())
+			m.Chat.Viewport.GotoBottom()
+			return m, nil, true
+		}
+		m.Chat.TextArea.Blur()
+		return m, execCommitCmd(msg.messageFile, msg.staged), true
+
 	case termFinishedMsg:
 		if msg.cmdStr != "" {
 			resType := types.ShellCmdResultMessage
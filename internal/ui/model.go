@@ -5,7 +5,6 @@ import (
 	"github.com/sokinpui/coder/internal/commands"
 	"github.com/sokinpui/coder/internal/config"
 	"github.com/sokinpui/coder/internal/session"
-	"github.com/sokinpui/coder/internal/token"
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/internal/utils"
 	"sort"
@@ -76,7 +75,7 @@ func (m *Model) ClearCache() {
 
 func (m *Model) UpdateTokenCount() {
 	if m.Session != nil {
-		m.TokenCount = token.CountTokens(m.Session.GetPrompt())
+		m.TokenCount = m.Session.PromptTokens()
 	}
 }
 
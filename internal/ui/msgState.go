@@ -76,9 +76,19 @@ type (
 		results []string
 		mode    finderMode
 	}
+	verifyFinishedMsg struct {
+		command string
+		output  string
+		err     error
+	}
 	termFinishedMsg struct {
 		cmdStr string
 		output string
 		err    error
 	}
+	commitPreparedMsg struct {
+		messageFile string
+		staged      []string
+		err         error
+	}
 )
@@ -0,0 +1,58 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/sokinpui/coder/internal/commands"
+	"github.com/sokinpui/coder/internal/types"
+	"github.com/sokinpui/coder/pkg/itf"
+)
+
+func formatStreamResult(r itf.FileResult) string {
+	line := fmt.Sprintf("%s %s: %s", r.Action, r.Path, r.Status)
+	if r.NewPath != "" {
+		line = fmt.Sprintf("%s %s -> %s: %s", r.Action, r.Path, r.NewPath, r.Status)
+	}
+	if r.Error != "" {
+		line += " (" + r.Error + ")"
+	}
+	return line
+}
+
+func (m Model) feedStreamApply(content string) Model {
+	if m.Chat.StreamApplier == nil {
+		return m
+	}
+	for _, r := range m.Chat.StreamApplier.Write(content) {
+		m.Chat.StreamApplyLog = append(m.Chat.StreamApplyLog, formatStreamResult(r))
+	}
+	return m
+}
+
+// finishStreamApply closes the streaming applier and logs its summary the same
+// way /itf does. It reports whether any file was changed.
+func (m Model) finishStreamApply() (Model, bool) {
+	applier := m.Chat.StreamApplier
+	m.Chat.StreamApplier = nil
+	m.Chat.StreamApplyLog = nil
+	if applier == nil {
+		return m, false
+	}
+
+	res := commands.FinishStreamItf(applier, m.Session)
+	if !res.Success {
+		m.Session.AddMessages(
+			types.Message{Type: types.CommandMessage, Content: "/itf"},
+			types.Message{Type: types.CommandErrorResultMessage, Content: res.Summary},
+		)
+		return m, false
+	}
+	if !res.HasChanges() && len(res.Raw["Failed"]) == 0 && len(res.Raw["Stale"]) == 0 {
+		return m, false
+	}
+	m.Session.AddMessages(
+		types.Message{Type: types.CommandMessage, Content: "/itf"},
+		types.Message{Type: types.CommandResultMessage, Content: res.Summary},
+	)
+	return m, res.HasChanges()
+}
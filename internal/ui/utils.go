@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/sokinpui/coder/internal/commands"
 	"github.com/sokinpui/coder/internal/config"
 	"github.com/sokinpui/coder/internal/history"
 	"github.com/sokinpui/coder/internal/session"
 	"github.com/sokinpui/coder/internal/types"
 	"github.com/sokinpui/coder/internal/utils"
+	"github.com/sokinpui/coder/pkg/itf"
 	"net/http"
 	"os"
 	"os/exec"
@@ -220,6 +222,34 @@ func execTerminalCmd(cmdStr string) tea.Cmd {
 	})
 }
 
+// prepareCommitCmd stages the files of the last apply, including deleted and
+// renamed ones, and generates the commit message off the update loop.
+func prepareCommitCmd(cfg *config.Config) tea.Cmd {
+	return func() tea.Msg {
+		paths, _ := itf.LastAppliedPaths()
+		messageFile, staged, err := commands.PrepareCommit(cfg, paths)
+		return commitPreparedMsg{messageFile: messageFile, staged: staged, err: err}
+	}
+}
+
+// execCommitCmd runs git commit with the generated message, letting the user
+// edit it first, and reports the new commit. Paths staged for the commit are
+// unstaged again when it is abandoned.
+func execCommitCmd(messageFile string, staged []string) tea.Cmd {
+	c := utils.CommitCommand(messageFile)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		defer os.Remove(messageFile)
+		if err != nil {
+			if unstageErr := utils.UnstagePaths(staged); unstageErr != nil {
+				err = fmt.Errorf("%w (and failed to unstage %s: %v)", err, strings.Join(staged, ", "), unstageErr)
+			}
+			return termFinishedMsg{cmdStr: "git commit", err: err}
+		}
+		output, _ := utils.LastCommit()
+		return termFinishedMsg{cmdStr: "git commit", output: "Committed " + output}
+	})
+}
+
 func getVisibleLines(ta textarea.Model, width int, maxLines int) int {
 	if width <= 0 {
 		// Avoid division by zero and handle cases where width is not yet set.
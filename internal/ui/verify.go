@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sokinpui/coder/internal/commands"
+	"github.com/sokinpui/coder/internal/types"
+)
+
+const (
+	verifyTimeout   = 5 * time.Minute
+	verifyFixPrompt = "The verify command `%s` failed after applying your changes. Its output is shown above. Fix the errors."
+)
+
+func runVerifyCmd(command string) tea.Cmd {
+	return func() tea.Msg {
+		output, err := commands.RunSafeShellCommand(command, verifyTimeout)
+		return verifyFinishedMsg{command: command, output: output, err: err}
+	}
+}
+
+// startVerify runs the configured verify command after a successful apply.
+func (m Model) startVerify() (Model, tea.Cmd) {
+	command := strings.TrimSpace(m.Session.GetConfig().Verify.Command)
+	if command == "" || m.Chat.IsVerifying {
+		return m, nil
+	}
+	m.Chat.IsVerifying = true
+	m.StatusBarMessage = fmt.Sprintf("Verifying: %s", command)
+	return m, runVerifyCmd(command)
+}
+
+func (m Model) handleVerifyFinished(msg verifyFinishedMsg) (Model, tea.Cmd) {
+	m.Chat.IsVerifying = false
+	m.StatusBarMessage = ""
+
+	// Appending while a response streams would split the AI message.
+	if m.Chat.IsStreaming {
+		m.Chat.VerifyIteration = 0
+		if msg.err != nil {
+			m.StatusBarMessage = fmt.Sprintf("Verify failed: %s", msg.command)
+		}
+		return m, clearStatusBarCmd()
+	}
+
+	output := msg.output
+	if output == "" {
+		if msg.err != nil {
+			output = fmt.Sprintf("Error: %v", msg.err)
+		} else {
+			output = "Command completed with no output."
+		}
+	}
+	m.Session.AddMessages(
+		types.Message{Type: types.ShellCmdMessage, Content: msg.command},
+		types.Message{Type: types.ShellCmdResultMessage, Content: output},
+	)
+
+	cfg := m.Session.GetConfig().Verify
+	switch {
+	case msg.err == nil:
+		m.Chat.VerifyIteration = 0
+		m.StatusBarMessage = "Verify passed."
+	case !cfg.AutoFix:
+		m.Chat.VerifyIteration = 0
+		m.StatusBarMessage = "Verify failed."
+	case m.Chat.VerifyIteration >= cfg.MaxIterations:
+		m.Session.AddMessages(types.Message{
+			Type:    types.CommandErrorResultMessage,
+			Content: fmt.Sprintf("Verify still failing after %d fix attempts.", m.Chat.VerifyIteration),
+		})
+		m.Chat.VerifyIteration = 0
+	default:
+		m.Chat.VerifyIteration++
+		m.Session.AddMessages(types.Message{Type: types.UserMessage, Content: fmt.Sprintf(verifyFixPrompt, msg.command)})
+		event := m.Session.StartGeneration()
+		if event.Type == types.GenerationStarted {
+			m.Chat.VerifyFixPending = true
+			return m.startGeneration(event)
+		}
+		m.Chat.VerifyIteration = 0
+	}
+
+	m.Chat.Viewport.SetContent(m.renderConversation())
+	m.Chat.Viewport.GotoBottom()
+	m.UpdateTokenCount()
+	return m, clearStatusBarCmd()
+}
@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const checkpointRefPrefix = "refs/coder/"
+
+// baseCommitSubject marks the commits CreateCheckpoint makes for edits that
+// were in the working tree before an apply. They are parents of checkpoints,
+// not checkpoints themselves, so ListCheckpoints skips them.
+const baseCommitSubject = "coder: uncommitted changes before apply"
+
+type Checkpoint struct {
+	Commit  string
+	Time    time.Time
+	Subject string
+}
+
+// runGit runs git in dir with extra environment variables and returns its
+// trimmed stdout.
+func runGit(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func CheckpointRef(session string) string {
+	return checkpointRefPrefix + session
+}
+
+// SnapshotWorktree returns the tree of the working tree as `git add -A` would
+// stage it, without touching the real index. A checkpoint takes it before an
+// apply, so that edits the user had not committed are not attributed to the
+// apply.
+func SnapshotWorktree() (string, error) {
+	root, err := FindRepoRoot()
+	if err != nil {
+		return "", err
+	}
+	tmpDir, err := os.MkdirTemp("", "coder-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	index := filepath.Join(tmpDir, "index")
+	env := []string{"GIT_INDEX_FILE=" + index}
+
+	// Starting from a copy of the real index lets git reuse its stat data
+	// instead of hashing every file.
+	realIndex, err := runGit(root, nil, "rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	if data, err := os.ReadFile(realIndex); err == nil {
+		if err := os.WriteFile(index, data, 0644); err != nil {
+			return "", err
+		}
+	} else if _, err := runGit(root, env, "read-tree", "--empty"); err != nil {
+		return "", err
+	}
+
+	if _, err := runGit(root, env, "add", "-A", "--", "."); err != nil {
+		return "", err
+	}
+	return runGit(root, env, "write-tree")
+}
+
+// CreateCheckpoint commits the current content of paths on top of the
+// session's checkpoint ref, or HEAD for the first checkpoint. When base, a
+// tree from SnapshotWorktree taken before the apply, has other content for
+// paths than the parent, that content is committed first, so the checkpoint
+// only holds the apply's own changes. It builds the trees in a temporary
+// index, so the real index, HEAD and working tree are left untouched. Paths
+// are relative to the working directory; missing paths are recorded as
+// deleted.
+func CreateCheckpoint(session, message string, paths []string, base string) (string, error) {
+	if len(paths) == 0 {
+		return "", nil
+	}
+	root, err := FindRepoRoot()
+	if err != nil {
+		return "", err
+	}
+	wd, _ := os.Getwd()
+	ref := CheckpointRef(session)
+
+	parent, err := runGit(root, nil, "rev-parse", "--verify", "--quiet", ref)
+	if err != nil || parent == "" {
+		parent, _ = runGit(root, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	}
+
+	// git refuses an empty file as an index, so read-tree creates it inside a
+	// temporary directory.
+	tmpDir, err := os.MkdirTemp("", "coder-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, "index")}
+
+	if parent != "" {
+		if _, err := runGit(root, env, "read-tree", parent); err != nil {
+			return "", err
+		}
+	} else if _, err := runGit(root, env, "read-tree", "--empty"); err != nil {
+		return "", err
+	}
+
+	var rels []string
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(wd, p)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+
+	if base != "" {
+		if parent, err = commitBase(root, env, parent, base, rels); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := runGit(root, env, append([]string{"update-index", "--add", "--remove", "--"}, rels...)...); err != nil {
+		return "", err
+	}
+	return commitIndex(root, env, ref, parent, message)
+}
+
+// commitBase sets paths in the temporary index to their content in base and
+// commits the result on top of parent when it differs. It returns the commit
+// the checkpoint goes on top of.
+func commitBase(root string, env []string, parent, base string, paths []string) (string, error) {
+	// Entries with mode 0 remove the paths; those base has are added back.
+	var info strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&info, "0 %s\t%s\x00", strings.Repeat("0", 40), p)
+	}
+	entries, err := runGit(root, nil, append([]string{"ls-tree", "-r", "-z", "--full-tree", base, "--"}, paths...)...)
+	if err != nil {
+		return "", err
+	}
+	info.WriteString(entries)
+
+	cmd := exec.Command("git", "update-index", "-z", "--index-info")
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(info.String())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git update-index: %s", strings.TrimSpace(string(out)))
+	}
+
+	tree, err := runGit(root, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	if parent != "" {
+		if parentTree, _ := runGit(root, nil, "rev-parse", parent+"^{tree}"); parentTree == tree {
+			return parent, nil
+		}
+	}
+	return commitIndex(root, env, "", parent, baseCommitSubject)
+}
+
+// commitIndex commits the temporary index on top of parent and points ref at
+// the commit when ref is set.
+func commitIndex(root string, env []string, ref, parent, message string) (string, error) {
+	tree, err := runGit(root, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	commitArgs := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		commitArgs = append(commitArgs, "-p", parent)
+	}
+	commit, err := runGit(root, identityEnv(root), commitArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	if ref == "" {
+		return commit, nil
+	}
+	if _, err := runGit(root, nil, "update-ref", "-m", "coder checkpoint", ref, commit); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// identityEnv supplies a fallback author when git has none configured, so
+// checkpoints work in fresh repositories.
+func identityEnv(root string) []string {
+	if _, err := runGit(root, nil, "var", "GIT_AUTHOR_IDENT"); err == nil {
+		return nil
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=coder", "GIT_AUTHOR_EMAIL=coder@localhost",
+		"GIT_COMMITTER_NAME=coder", "GIT_COMMITTER_EMAIL=coder@localhost",
+	}
+}
+
+// ListCheckpoints returns the session's checkpoints, oldest first. Commits
+// reachable from HEAD and the base commits of CreateCheckpoint are not
+// checkpoints and are skipped.
+func ListCheckpoints(session string) ([]Checkpoint, error) {
+	root, err := FindRepoRoot()
+	if err != nil {
+		return nil, err
+	}
+	ref := CheckpointRef(session)
+	if _, err := runGit(root, nil, "rev-parse", "--verify", "--quiet", ref); err != nil {
+		return nil, nil
+	}
+
+	args := []string{"log", "--reverse", "--format=%H%x09%ct%x09%s", ref}
+	if _, err := runGit(root, nil, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		args = append(args, "--not", "HEAD")
+	}
+	out, err := runGit(root, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []Checkpoint
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 || parts[2] == baseCommitSubject {
+			continue
+		}
+		ts, _ := strconv.ParseInt(parts[1], 10, 64)
+		checkpoints = append(checkpoints, Checkpoint{Commit: parts[0], Time: time.Unix(ts, 0), Subject: parts[2]})
+	}
+	return checkpoints, nil
+}
+
+// CheckpointDiff returns the changes recorded by a checkpoint.
+func CheckpointDiff(commit string) (string, error) {
+	root, err := FindRepoRoot()
+	if err != nil {
+		return "", err
+	}
+	return runGit(root, nil, "show", "--format=", "--no-color", commit)
+}
+
+// RestoreCheckpoint writes the files changed by a checkpoint back to the
+// working tree as they were at that checkpoint, without touching the index.
+// It returns the restored paths relative to the project root.
+func RestoreCheckpoint(commit string) ([]string, error) {
+	root, err := FindRepoRoot()
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(root, nil, "diff-tree", "-r", "--root", "--no-commit-id", "--name-status", "--no-renames", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var restored []string
+	for _, line := range strings.Split(out, "\n") {
+		status, path, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if status == "D" {
+			if err := os.Remove(filepath.Join(root, path)); err != nil && !os.IsNotExist(err) {
+				return restored, err
+			}
+		} else if _, err := runGit(root, nil, "restore", "--source="+commit, "--worktree", "--", path); err != nil {
+			return restored, err
+		}
+		restored = append(restored, path)
+	}
+	return restored, nil
+}
+
+// StagedDiff returns the diff of the index against HEAD.
+func StagedDiff() (string, error) {
+	return runGit("", nil, "diff", "--staged", "--no-color")
+}
+
+// StagePaths stages the given paths, including deletions. Paths are relative
+// to the working directory.
+func StagePaths(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	_, err := runGit("", nil, append([]string{"add", "-A", "--"}, paths...)...)
+	return err
+}
+
+// UnstagePaths resets the index entries of paths to HEAD, undoing StagePaths
+// when nothing else was staged.
+func UnstagePaths(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	_, err := runGit("", nil, append([]string{"reset", "-q", "--"}, paths...)...)
+	return err
+}
+
+// CommitCommand returns a git commit that opens messageFile in the user's
+// editor before committing the index.
+func CommitCommand(messageFile string) *exec.Cmd {
+	return exec.Command("git", "commit", "-e", "-F", messageFile)
+}
+
+// LastCommit returns the short hash and subject of HEAD.
+func LastCommit() (string, error) {
+	return runGit("", nil, "log", "-1", "--format=%h %s")
+}
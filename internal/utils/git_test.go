@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// newTestRepo makes a git repository in a temporary working directory with
+// one commit holding files.
+func newTestRepo(t *testing.T, files map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Chdir(t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@localhost")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@localhost")
+
+	git(t, "init", "-q")
+	for name, content := range files {
+		writeFile(t, name, content)
+	}
+	git(t, "add", "-A")
+	git(t, "commit", "-q", "-m", "initial")
+}
+
+func git(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := runGit("", nil, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCheckpointKeepsUncommittedEditsOut(t *testing.T) {
+	newTestRepo(t, map[string]string{"a.txt": "one\n", "b.txt": "bee\n"})
+	indexBefore := git(t, "ls-files", "-s")
+
+	// The user edits a.txt before the apply, which then edits it again and
+	// deletes b.txt.
+	writeFile(t, "a.txt", "one\nuser\n")
+	base, err := SnapshotWorktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "a.txt", "one\nuser\napply\n")
+	if err := os.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := CreateCheckpoint("s1", "apply 1", []string{"a.txt", "b.txt"}, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints, err := ListCheckpoints("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Commit != commit || checkpoints[0].Subject != "apply 1" {
+		t.Fatalf("checkpoints = %+v, want only the apply", checkpoints)
+	}
+	if parent := git(t, "log", "-1", "--format=%s", commit+"^"); parent != baseCommitSubject {
+		t.Errorf("checkpoint parent = %q, want the base commit", parent)
+	}
+
+	diff, err := CheckpointDiff(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+apply") || strings.Contains(diff, "+user") || !strings.Contains(diff, "deleted file mode") {
+		t.Errorf("diff = %s\nwant the apply's changes only", diff)
+	}
+
+	if got := git(t, "ls-files", "-s"); got != indexBefore {
+		t.Errorf("real index changed:\n%s\nwant\n%s", got, indexBefore)
+	}
+	if got := git(t, "log", "--format=%s"); got != "initial" {
+		t.Errorf("HEAD history = %q", got)
+	}
+}
+
+func TestCheckpointWithoutBaseChanges(t *testing.T) {
+	newTestRepo(t, map[string]string{"a.txt": "one\n"})
+	base, err := SnapshotWorktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "a.txt", "two\n")
+	commit, err := CreateCheckpoint("s1", "apply 1", []string{"a.txt"}, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A clean tree needs no base commit.
+	if parent := git(t, "rev-parse", commit+"^"); parent != git(t, "rev-parse", "HEAD") {
+		t.Errorf("checkpoint parent = %s, want HEAD", parent)
+	}
+
+	writeFile(t, "a.txt", "three\n")
+	second, err := CreateCheckpoint("s1", "apply 2", []string{"a.txt"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints, err := ListCheckpoints("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0].Commit != commit || checkpoints[1].Commit != second {
+		t.Fatalf("checkpoints = %+v", checkpoints)
+	}
+	if other, _ := ListCheckpoints("s2"); len(other) != 0 {
+		t.Errorf("other session has checkpoints %+v", other)
+	}
+}
+
+func TestRestoreCheckpoint(t *testing.T) {
+	newTestRepo(t, map[string]string{"a.txt": "one\n", "b.txt": "bee\n"})
+	writeFile(t, "a.txt", "two\n")
+	writeFile(t, "c.txt", "new\n")
+	if err := os.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := CreateCheckpoint("s1", "apply 1", []string{"a.txt", "b.txt", "c.txt"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, "a.txt", "later\n")
+	writeFile(t, "b.txt", "back\n")
+	if err := os.Remove("c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreCheckpoint(commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(restored, ",") != "a.txt,b.txt,c.txt" {
+		t.Errorf("restored = %v", restored)
+	}
+	if got := readFile(t, "a.txt"); got != "two\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if got := readFile(t, "c.txt"); got != "new\n" {
+		t.Errorf("c.txt = %q", got)
+	}
+	if _, err := os.Stat("b.txt"); !os.IsNotExist(err) {
+		t.Errorf("b.txt still exists: %v", err)
+	}
+}
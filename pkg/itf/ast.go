@@ -14,54 +14,102 @@ type CodeBlock struct {
 
 func ExtractCodeBlocks(source []byte) ([]CodeBlock, error) {
 	var blocks []CodeBlock
-	var currentBlock *CodeBlock
-	var fenceChar byte
-	var fenceCount int
-	var lastNonEmptyLine string
+	p := NewStreamParser()
 
 	scanner := bufio.NewScanner(bytes.NewReader(source))
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		if currentBlock == nil {
-			char, count, ok := parseOpeningFence(line)
-			if ok {
-				fenceChar = char
-				fenceCount = count
-				currentBlock = &CodeBlock{
-					Lang: strings.TrimSpace(line[count:]),
-					Hint: lastNonEmptyLine,
-				}
-				continue
-			}
-
-			if trimmed := strings.TrimSpace(line); trimmed != "" {
-				lastNonEmptyLine = trimmed
-			}
-			continue
-		}
-
-		if isClosingFence(line, fenceChar, fenceCount) {
-			blocks = append(blocks, *currentBlock)
-			currentBlock = nil
-			lastNonEmptyLine = ""
-			continue
+		if b, ok := p.parseLine(scanner.Text()); ok {
+			blocks = append(blocks, b)
 		}
-
-		currentBlock.Content += line + "\n"
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	if currentBlock != nil {
-		blocks = append(blocks, *currentBlock)
+	if p.current != nil {
+		blocks = append(blocks, *p.current)
 	}
 
 	return blocks, nil
 }
 
+// StreamParser extracts code blocks from content that arrives in chunks. A
+// block is returned as soon as its closing fence is seen.
+type StreamParser struct {
+	pending          string
+	current          *CodeBlock
+	fenceChar        byte
+	fenceCount       int
+	lastNonEmptyLine string
+}
+
+func NewStreamParser() *StreamParser {
+	return &StreamParser{}
+}
+
+// Write consumes a chunk and returns the blocks it completed.
+func (p *StreamParser) Write(chunk string) []CodeBlock {
+	var blocks []CodeBlock
+	p.pending += chunk
+	for {
+		i := strings.IndexByte(p.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(p.pending[:i], "\r")
+		p.pending = p.pending[i+1:]
+		if b, ok := p.parseLine(line); ok {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+// Flush processes any buffered partial line and returns the blocks it
+// completed. A trailing block whose closing fence never arrived, as when the
+// stream was cancelled or cut off, is dropped and returned as incomplete.
+func (p *StreamParser) Flush() (blocks []CodeBlock, incomplete *CodeBlock) {
+	if p.pending != "" {
+		if b, ok := p.parseLine(strings.TrimSuffix(p.pending, "\r")); ok {
+			blocks = append(blocks, b)
+		}
+		p.pending = ""
+	}
+	incomplete, p.current = p.current, nil
+	return blocks, incomplete
+}
+
+func (p *StreamParser) parseLine(line string) (CodeBlock, bool) {
+	if p.current == nil {
+		char, count, ok := parseOpeningFence(line)
+		if ok {
+			p.fenceChar = char
+			p.fenceCount = count
+			p.current = &CodeBlock{
+				Lang: strings.TrimSpace(line[count:]),
+				Hint: p.lastNonEmptyLine,
+			}
+			return CodeBlock{}, false
+		}
+
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			p.lastNonEmptyLine = trimmed
+		}
+		return CodeBlock{}, false
+	}
+
+	if isClosingFence(line, p.fenceChar, p.fenceCount) {
+		b := *p.current
+		p.current = nil
+		p.lastNonEmptyLine = ""
+		return b, true
+	}
+
+	p.current.Content += line + "\n"
+	return CodeBlock{}, false
+}
+
 func parseOpeningFence(line string) (byte, int, bool) {
 	if len(line) < 3 {
 		return 0, 0, false
@@ -15,6 +15,11 @@ type CLIConfig struct {
 	Extensions  []string
 	Completion  string
 	Files       []string
+	Formatters  []string
+	Protected   []string
+	Allow       []string
+	AllowLarge  bool
+	JSON        bool
 }
 
 var cfg = &CLIConfig{}
@@ -37,11 +42,24 @@ Example: pbpaste | itf -e py`,
 
 		normalizeExtensions()
 
+		var formatters []Formatter
+		for _, spec := range cfg.Formatters {
+			f, err := ParseFormatter(spec)
+			if err != nil {
+				return err
+			}
+			formatters = append(formatters, f)
+		}
+
 		itfCfg := &Config{
 			Undo:       cfg.Undo,
 			Redo:       cfg.Redo,
 			Extensions: cfg.Extensions,
 			Files:      cfg.Files,
+			Formatters: formatters,
+			Protected:  cfg.Protected,
+			Allow:      cfg.Allow,
+			AllowLarge: cfg.AllowLarge,
 		}
 
 		app, err := NewApp(itfCfg)
@@ -49,11 +67,50 @@ Example: pbpaste | itf -e py`,
 			return fmt.Errorf("failed to initialize application: %w", err)
 		}
 
+		if cfg.JSON {
+			summary, err := app.Execute()
+			if err != nil {
+				return err
+			}
+			out, err := FormatJSON(summary)
+			if err != nil {
+				return err
+			}
+			fmt.Println(out)
+			return nil
+		}
+
 		ui := NewTUI(app, cfg.NoAnimation)
 		return ui.Run()
 	},
 }
 
+var fsckCmd = &cobra.Command{
+	Use:           "fsck",
+	Short:         "Check the undo history against the stored blobs.",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sm, err := openStateManager()
+		if err != nil {
+			return err
+		}
+		problems, err := sm.Check()
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problem(s) in %s", len(problems), sm.statePath)
+		}
+		fmt.Printf("ok: %d entries\n", sm.EntryCount())
+		return nil
+	},
+}
+
 func handleCompletion(cmd *cobra.Command) error {
 	switch cfg.Completion {
 	case "bash":
@@ -82,9 +139,15 @@ func init() {
 	rootCmd.Flags().BoolVar(&cfg.NoAnimation, "no-animation", false, "Disable spinner")
 	rootCmd.Flags().StringSliceVarP(&cfg.Extensions, "extension", "e", []string{}, "Filter by extension")
 	rootCmd.Flags().StringSliceVarP(&cfg.Files, "file", "f", []string{}, "Filter by files")
+	rootCmd.Flags().StringArrayVar(&cfg.Formatters, "formatter", []string{}, "Run a formatter on written files matching a glob (glob=command)")
+	rootCmd.Flags().StringSliceVar(&cfg.Protected, "protect", []string{}, "Refuse to write paths matching these globs")
+	rootCmd.Flags().StringSliceVar(&cfg.Allow, "allow", []string{}, "Allow writing these paths despite the write policy")
+	rootCmd.Flags().BoolVar(&cfg.AllowLarge, "allow-large", false, "Allow writing binary files and overwriting large files")
+	rootCmd.Flags().BoolVar(&cfg.JSON, "json", false, "Print the result as JSON")
 	rootCmd.Flags().BoolVarP(&cfg.Undo, "undo", "u", false, "Undo last op")
 	rootCmd.Flags().BoolVarP(&cfg.Redo, "redo", "r", false, "Redo last op")
 
+	rootCmd.AddCommand(fsckCmd)
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
 }
 
@@ -0,0 +1,20 @@
+package itf
+
+import "strings"
+
+// diagnoseHunk locates the region the model most likely meant to edit so the
+// failure can be shown next to the real text. It scores windows the way
+// matchFuzzyWindow does but reports the best one even below its threshold.
+// Like the match, it only looks past searchStart, where the previous hunk
+// ended.
+func diagnoseHunk(source []string, h diffHunk, searchStart int) *HunkDiagnostic {
+	d := &HunkDiagnostic{Hunk: strings.Join(h.raw, "\n"), Expected: h.target}
+	start, end, score := bestFuzzyWindow(source, h.target, searchStart)
+	if start == -1 {
+		return d
+	}
+
+	d.Line, d.EndLine, d.Score = start+1, end, score
+	d.Actual = append([]string{}, source[start:end]...)
+	return d
+}
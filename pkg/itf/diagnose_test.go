@@ -0,0 +1,55 @@
+package itf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDiagnoseHunk(t *testing.T) {
+	source := []string{"package main", "", "func a() {", "\treturn 1", "}", "", "func b() {", "\treturn 2", "}"}
+	h := diffHunk{target: []string{"func b() {", "\treturn 3", "}"}}
+
+	d := diagnoseHunk(source, h, 0)
+	if d.Line != 7 || d.EndLine != 9 {
+		t.Fatalf("closest region = %d-%d, want 7-9", d.Line, d.EndLine)
+	}
+	if d.Score <= 0 || d.Score >= 1 {
+		t.Errorf("score = %v", d.Score)
+	}
+}
+
+func TestDiagnoseHunkAfterPreviousHunk(t *testing.T) {
+	source := []string{
+		"func a() {", "\tx := 1", "\ty := 2", "\treturn x + y", "}",
+		"",
+		"func b() {", "\tx := 1", "\ty := 2", "\treturn x * y", "}",
+	}
+	diff := "@@ -1,5 +1,5 @@\n func a() {\n \tx := 1\n \ty := 2\n-\treturn x + y\n+\treturn x - y\n }\n" +
+		"@@ -7,5 +7,5 @@\n func c() {\n \tx := 1\n \ty := 2\n-\treturn x / y\n+\treturn x % y\n }\n"
+
+	_, err := ApplyDiff(source, diff)
+	var he *HunkError
+	if !errors.As(err, &he) || he.Hunk != 2 {
+		t.Fatalf("err = %v, want hunk #2 to fail", err)
+	}
+	// a and b are as close to the second hunk, but the first hunk already
+	// consumed a.
+	if d := he.Diagnostic; d.Line < 7 || d.EndLine > 11 {
+		t.Errorf("closest region = %d-%d, want it within b at 7-11", d.Line, d.EndLine)
+	}
+}
+
+func TestFormatDiagnosticTruncatesRunes(t *testing.T) {
+	long := strings.Repeat("é", diagnosticColumnWidth+10)
+	out := formatDiagnostic(FileResult{Path: "a.txt", Hunk: 1, Diagnostic: &HunkDiagnostic{
+		Line: 1, EndLine: 1, Score: 0.5, Expected: []string{long}, Actual: []string{long},
+	}})
+	if !utf8.ValidString(out) {
+		t.Fatalf("output is not valid UTF-8: %q", out)
+	}
+	if !strings.Contains(out, strings.Repeat("é", diagnosticColumnWidth-3)+"...") {
+		t.Errorf("line not truncated to %d columns:\n%s", diagnosticColumnWidth, out)
+	}
+}
@@ -1,12 +1,16 @@
 package itf
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
+// errContentModified means a file changed after the operation being undone or
+// redone, so reverting it would lose those changes.
+var errContentModified = errors.New("content modified since last operation")
+
 type FileManager struct{}
 
 func NewFileManager() *FileManager {
@@ -15,12 +19,8 @@ func NewFileManager() *FileManager {
 
 func (m *FileManager) WriteChanges(changes []FileChange, progressCb func(int)) (updated, failed []string) {
 	for i, change := range changes {
-		content := strings.Join(change.Content, "\n")
-		if len(change.Content) > 0 {
-			content += "\n"
-		}
-
-		if err := os.WriteFile(change.Path, []byte(content), 0644); err != nil {
+		format := detectTextFormat(change.Path)
+		if err := writeFilePreserving(change.Path, format.encode(change.Content), format.mode); err != nil {
 			failed = append(failed, fmt.Sprintf("%s: %v", change.Path, err))
 			continue
 		}
@@ -36,23 +36,47 @@ func (m *FileManager) WriteChanges(changes []FileChange, progressCb func(int)) (
 func (m *FileManager) Undo(ops []Operation, stateDir string, projectRoot string) Summary {
 	var s Summary
 	for _, op := range ops {
-		if err := m.undoFile(op, stateDir, projectRoot); err != nil {
-			s.Failed = append(s.Failed, fmt.Sprintf("%s: %v", op.Path, err))
-			continue
+		r := FileResult{Path: op.Path, Action: undoActions[op.Action], Status: StatusApplied}
+		if op.Action == "rename" {
+			r.Path, r.NewPath = op.NewPath, op.Path
 		}
+		s.add(r, m.undoFile(op, stateDir, projectRoot))
+	}
+	return s
+}
+
+// undoActions maps an operation to the action that reverts it.
+var undoActions = map[string]string{
+	"create": "delete",
+	"delete": "create",
+	"modify": "modify",
+	"rename": "rename",
+}
 
-		switch op.Action {
-		case "create":
-			s.Deleted = append(s.Deleted, op.Path)
-		case "delete":
-			s.Created = append(s.Created, op.Path)
-		case "modify":
-			s.Modified = append(s.Modified, op.Path)
-		case "rename":
-			s.Renamed = append(s.Renamed, fmt.Sprintf("%s -> %s", op.NewPath, op.Path))
+// add records the outcome of an undo or redo step in both the display lists
+// and the structured results.
+func (s *Summary) add(r FileResult, err error) {
+	if err != nil {
+		r.Status, r.ErrorKind, r.Error = StatusFailed, ErrKindIO, err.Error()
+		if errors.Is(err, errContentModified) {
+			r.ErrorKind = ErrKindStale
 		}
+		s.Failed = append(s.Failed, fmt.Sprintf("%s: %v", r.Path, err))
+		s.Results = append(s.Results, r)
+		return
 	}
-	return s
+
+	switch r.Action {
+	case "create":
+		s.Created = append(s.Created, r.Path)
+	case "delete":
+		s.Deleted = append(s.Deleted, r.Path)
+	case "modify":
+		s.Modified = append(s.Modified, r.Path)
+	case "rename":
+		s.Renamed = append(s.Renamed, fmt.Sprintf("%s -> %s", r.Path, r.NewPath))
+	}
+	s.Results = append(s.Results, r)
 }
 
 func (m *FileManager) undoFile(op Operation, stateDir string, projectRoot string) error {
@@ -69,7 +93,7 @@ func (m *FileManager) undoFile(op Operation, stateDir string, projectRoot string
 
 	actualHash, _ := GetFileSHA256(checkPath)
 	if actualHash != op.ContentHash {
-		return fmt.Errorf("content modified since last operation")
+		return errContentModified
 	}
 
 	if op.Action == "rename" {
@@ -89,27 +113,14 @@ func (m *FileManager) undoFile(op Operation, stateDir string, projectRoot string
 		return fmt.Errorf("failed to read backup blob: %w", err)
 	}
 
-	return os.WriteFile(op.Path, content, 0644)
+	return writeFilePreserving(op.Path, content, fileMode(op.Path))
 }
 
 func (m *FileManager) Redo(ops []Operation, stateDir string, projectRoot string) Summary {
 	var s Summary
 	for _, op := range ops {
-		if err := m.redoFile(op, stateDir, projectRoot); err != nil {
-			s.Failed = append(s.Failed, fmt.Sprintf("%s: %v", op.Path, err))
-			continue
-		}
-
-		switch op.Action {
-		case "create":
-			s.Created = append(s.Created, op.Path)
-		case "delete":
-			s.Deleted = append(s.Deleted, op.Path)
-		case "modify":
-			s.Modified = append(s.Modified, op.Path)
-		case "rename":
-			s.Renamed = append(s.Renamed, fmt.Sprintf("%s -> %s", op.Path, op.NewPath))
-		}
+		r := FileResult{Path: op.Path, NewPath: op.NewPath, Action: op.Action, Status: StatusApplied}
+		s.add(r, m.redoFile(op, stateDir, projectRoot))
 	}
 	return s
 }
@@ -117,7 +128,7 @@ func (m *FileManager) Redo(ops []Operation, stateDir string, projectRoot string)
 func (m *FileManager) redoFile(op Operation, stateDir string, projectRoot string) error {
 	actualHash, _ := GetFileSHA256(op.Path)
 	if actualHash != op.OldContentHash {
-		return fmt.Errorf("content modified since last operation")
+		return errContentModified
 	}
 
 	if op.Action == "rename" {
@@ -136,5 +147,5 @@ func (m *FileManager) redoFile(op Operation, stateDir string, projectRoot string
 	if err := os.MkdirAll(filepath.Dir(op.Path), 0755); err != nil {
 		return err
 	}
-	return os.WriteFile(op.Path, content, 0644)
+	return writeFilePreserving(op.Path, content, fileMode(op.Path))
 }
@@ -0,0 +1,66 @@
+package itf
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Formatter runs Command on every created or modified file matching Pattern.
+// The file path is appended as the last argument and the command is expected
+// to rewrite the file in place (e.g. "gofmt -w", "prettier --write").
+type Formatter struct {
+	Pattern string
+	Command string
+}
+
+// ParseFormatter parses a "glob=command" specification.
+func ParseFormatter(spec string) (Formatter, error) {
+	pattern, command, ok := strings.Cut(spec, "=")
+	pattern, command = strings.TrimSpace(pattern), strings.TrimSpace(command)
+	if !ok || pattern == "" || command == "" {
+		return Formatter{}, fmt.Errorf("invalid formatter %q, expected glob=command", spec)
+	}
+	return Formatter{Pattern: pattern, Command: command}, nil
+}
+
+func (f Formatter) matches(path, root string) bool {
+	if ok, _ := filepath.Match(f.Pattern, filepath.Base(path)); ok {
+		return true
+	}
+	if rel, err := filepath.Rel(root, path); err == nil {
+		ok, _ := filepath.Match(f.Pattern, filepath.ToSlash(rel))
+		return ok
+	}
+	return false
+}
+
+// runFormatters formats the given files and returns a warning for every
+// formatter that failed. Failures never abort the apply.
+func (a *App) runFormatters(paths []string) []string {
+	if len(a.cfg.Formatters) == 0 {
+		return nil
+	}
+
+	var warnings []string
+	root := a.stateManager.ProjectRoot
+	for _, path := range paths {
+		for _, f := range a.cfg.Formatters {
+			if !f.matches(path, root) {
+				continue
+			}
+			args := strings.Fields(f.Command)
+			cmd := exec.Command(args[0], append(args[1:], path)...)
+			cmd.Dir = root
+			if out, err := cmd.CombinedOutput(); err != nil {
+				msg := strings.TrimSpace(string(out))
+				if msg == "" {
+					msg = err.Error()
+				}
+				warnings = append(warnings, fmt.Sprintf("%s: %s failed: %s", path, args[0], msg))
+			}
+		}
+	}
+	return warnings
+}
@@ -40,7 +40,10 @@ func IsEmptyDir(name string) (bool, error) {
 }
 
 type PathResolver struct {
-	wd string
+	wd   string
+	root string
+	// projectFiles caches the project listing used for path correction.
+	projectFiles []string
 }
 
 func NewPathResolver() (*PathResolver, error) {
@@ -48,7 +51,7 @@ func NewPathResolver() (*PathResolver, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not get current working directory: %w", err)
 	}
-	return &PathResolver{wd: wd}, nil
+	return &PathResolver{wd: wd, root: wd}, nil
 }
 
 func (r *PathResolver) Resolve(relativePath string) string {
@@ -2,27 +2,41 @@ package itf
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 )
 
 func Apply(content string, config Config) (map[string][]string, error) {
-	app, err := NewApp(&config)
+	summary, err := ApplySummary(content, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize itf app: %w", err)
+		return nil, err
 	}
+	return summary.Map(), nil
+}
 
-	summary, err := app.processAndApply(content)
+// ApplySummary applies content and returns the full summary, including the
+// per-file results.
+func ApplySummary(content string, config Config) (Summary, error) {
+	app, err := NewApp(&config)
 	if err != nil {
-		return nil, err
+		return Summary{}, fmt.Errorf("failed to initialize itf app: %w", err)
 	}
+	s, err := app.processAndApply(content)
+	app.reportStateProblems(&s)
+	return s, err
+}
 
+func (s Summary) Map() map[string][]string {
 	return map[string][]string{
-		"Created":  summary.Created,
-		"Modified": summary.Modified,
-		"Renamed":  summary.Renamed,
-		"Deleted":  summary.Deleted,
-		"Failed":   summary.Failed,
-		"Message":  []string{summary.Message},
-	}, nil
+		"Created":  s.Created,
+		"Modified": s.Modified,
+		"Renamed":  s.Renamed,
+		"Deleted":  s.Deleted,
+		"Failed":   s.Failed,
+		"Stale":    s.Stale,
+		"Warnings": s.Warnings,
+		"Message":  []string{s.Message},
+	}
 }
 
 func FormatResult(results map[string][]string) string {
@@ -41,6 +55,35 @@ func FormatResult(results map[string][]string) string {
 		Renamed:  results["Renamed"],
 		Deleted:  results["Deleted"],
 		Failed:   results["Failed"],
+		Stale:    results["Stale"],
+		Warnings: results["Warnings"],
 		Message:  msg,
 	})
 }
+
+// LastAppliedPaths returns the files touched by the latest applied history
+// entry, relative to the working directory.
+func LastAppliedPaths() ([]string, error) {
+	sm, err := NewStateManager()
+	if err != nil {
+		return nil, err
+	}
+	if sm.state.CurrentIndex < 0 {
+		return nil, nil
+	}
+
+	wd, _ := os.Getwd()
+	var paths []string
+	for _, op := range sm.state.History[sm.state.CurrentIndex].Operations {
+		for _, p := range []string{op.Path, op.NewPath} {
+			if p == "" {
+				continue
+			}
+			if rel, err := filepath.Rel(wd, p); err == nil {
+				p = rel
+			}
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime/debug"
 	"strings"
 )
@@ -11,8 +12,32 @@ import (
 type Config struct {
 	Undo       bool
 	Redo       bool
+	Force      bool
 	Extensions []string
 	Files      []string
+	// Baseline maps file paths to the SHA-256 they had when the model's prompt
+	// was built. Files whose content changed since then are not patched unless
+	// Force is set.
+	Baseline   map[string]string
+	Formatters []Formatter
+	// Protected lists globs, relative to the project root, that may not be
+	// written. Allow lists paths exempt from the write policy.
+	Protected []string
+	Allow     []string
+	// AllowLarge permits writing binary files, overwriting large files with
+	// whole-file blocks and changing files too large to back up.
+	AllowLarge bool
+	// Restore rewrites the content before its code blocks are parsed, e.g. to
+	// put back secrets that the model only saw as placeholders.
+	Restore func(string) string
+	// Placeholder matches text that may not be written: a write adding a
+	// match the file did not already contain is refused.
+	Placeholder *regexp.Regexp
+	// SessionID and MessageIndex tag the history entry written by an apply.
+	// With Undo, a set SessionID reverts that session's entry for
+	// MessageIndex, or its latest entry when MessageIndex is negative.
+	SessionID    string
+	MessageIndex int
 }
 
 type ProgressUpdate func(current, total int)
@@ -43,6 +68,7 @@ func NewApp(cfg *Config) (*App, error) {
 	if err != nil {
 		return nil, err
 	}
+	pr.root = sm.ProjectRoot
 
 	return &App{
 		cfg:            cfg,
@@ -65,8 +91,11 @@ func (a *App) Execute() (summary Summary, err error) {
 			err = &DetailedError{Err: fmt.Errorf("panic: %v", r), Stack: debug.Stack()}
 		}
 	}()
+	defer a.reportStateProblems(&summary)
 
 	switch {
+	case a.cfg.Undo && a.cfg.SessionID != "":
+		return a.undoSessionOperation()
 	case a.cfg.Undo:
 		return a.undoLastOperation()
 	case a.cfg.Redo:
@@ -85,14 +114,28 @@ func (a *App) processContent() (Summary, error) {
 }
 
 func (a *App) processAndApply(content string) (Summary, error) {
-	a.stateManager.Sync()
-	plan, err := CreatePlan(content, a.pathResolver, a.cfg.Extensions, a.cfg.Files)
+	unlock, err := a.stateManager.Lock()
 	if err != nil {
 		return Summary{}, err
 	}
+	defer unlock()
+
+	if err := a.stateManager.Sync(); err != nil {
+		return Summary{}, fmt.Errorf("failed to save history: %w", err)
+	}
+	policy := NewWritePolicy(a.stateManager.ProjectRoot, a.cfg.Protected, a.cfg.Allow, a.pathResolver)
+	policy.AllowLarge = a.cfg.AllowLarge
+	policy.Placeholder = a.cfg.Placeholder
+	plan, err := CreatePlan(a.restore(content), a.pathResolver, a.cfg.Extensions, a.cfg.Files, policy)
+	if err != nil {
+		return Summary{}, err
+	}
+	if !a.cfg.Force {
+		a.dropStaleActions(plan, nil)
+	}
 	if len(plan.Actions) == 0 {
-		if len(plan.Failed) > 0 {
-			s := Summary{Failed: plan.Failed}
+		if len(plan.Failed) > 0 || len(plan.Stale) > 0 {
+			s := Summary{Failed: plan.Failed, Stale: plan.Stale, Warnings: plan.Warnings, Results: a.relativizeResults(plan.Results)}
 			a.relativizeSummaryPaths(&s)
 			return s, nil
 		}
@@ -103,14 +146,109 @@ func (a *App) processAndApply(content string) (Summary, error) {
 	return a.applyChanges(plan)
 }
 
+func (a *App) restore(content string) string {
+	if a.cfg.Restore == nil {
+		return content
+	}
+	return a.cfg.Restore(content)
+}
+
+// dropStaleActions removes actions on files that changed since the baseline
+// hashes were taken. Paths in written were changed by this apply itself and
+// are not checked.
+func (a *App) dropStaleActions(plan *ExecutionPlan, written map[string]bool) {
+	if len(a.cfg.Baseline) == 0 {
+		return
+	}
+
+	baseline := make(map[string]string, len(a.cfg.Baseline))
+	for p, h := range a.cfg.Baseline {
+		baseline[a.pathResolver.Resolve(p)] = h
+	}
+
+	kept := plan.Actions[:0]
+	for _, action := range plan.Actions {
+		path := action.Path
+		switch action.Type {
+		case "write":
+			path = action.Change.Path
+		case "rename":
+			path = action.Rename.OldPath
+		}
+
+		expected, tracked := baseline[path]
+		if !tracked || written[path] {
+			kept = append(kept, action)
+			continue
+		}
+		if current, _ := GetFileSHA256(path); current != expected {
+			plan.Stale = append(plan.Stale, path)
+			kind := action.Type
+			if kind == "write" {
+				kind = plan.FileActions[path]
+			}
+			plan.Results = append(plan.Results, FileResult{
+				Path:      path,
+				Action:    kind,
+				Status:    StatusStale,
+				ErrorKind: ErrKindStale,
+				Error:     "changed on disk since the prompt was built",
+			})
+			continue
+		}
+		kept = append(kept, action)
+	}
+	plan.Actions = kept
+}
+
+// applyState accumulates the outcome of executed actions until they are
+// recorded as a single history entry.
+type applyState struct {
+	created, modified, deleted, renamed        []string
+	failedWrites, failedDeletes, failedRenames []string
+	renamedMap                                 map[string]string
+	oldHashes                                  map[string]string
+	results                                    []FileResult
+}
+
+func newApplyState() *applyState {
+	return &applyState{
+		renamedMap: make(map[string]string),
+		oldHashes:  make(map[string]string),
+	}
+}
+
+// dedupe collapses repeated writes to the same path, which happen when a
+// streamed response touches a file in several blocks.
+func (st *applyState) dedupe() {
+	seen := make(map[string]struct{})
+	unique := func(paths []string) []string {
+		var out []string
+		for _, p := range paths {
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			out = append(out, p)
+		}
+		return out
+	}
+	st.created = unique(st.created)
+	for _, p := range st.created {
+		delete(st.oldHashes, p)
+	}
+	st.modified = unique(st.modified)
+}
+
 func (a *App) applyChanges(plan *ExecutionPlan) (Summary, error) {
+	st := newApplyState()
+	a.executePlan(plan, st)
+	return a.finishApply(plan, st)
+}
+
+func (a *App) executePlan(plan *ExecutionPlan, st *applyState) {
 	totalOps := len(plan.Actions)
 	currentOp := 0
-	oldHashes := make(map[string]string)
-
-	var created, modified, deleted, renamedSuccess []string
-	var failedCreate, failedModify, failedDeletes, failedRenames []string
-	renamedMap := make(map[string]string)
 
 	progress := func() {
 		currentOp++
@@ -123,65 +261,88 @@ func (a *App) applyChanges(plan *ExecutionPlan) (Summary, error) {
 		switch action.Type {
 		case "write":
 			isCreate := plan.FileActions[action.Change.Path] == "create"
+			var oldLines []string
 			if !isCreate {
-				a.backupFileState(action.Change.Path, oldHashes)
+				a.backupFileState(action.Change.Path, st.oldHashes)
+				oldLines = readLines(action.Change.Path)
 			}
 
 			upd, fail := a.fileManager.WriteChanges([]FileChange{*action.Change}, nil)
+			r := FileResult{Path: action.Change.Path, Action: plan.FileActions[action.Change.Path], Status: StatusApplied}
 			if len(fail) > 0 {
-				if isCreate {
-					failedCreate = append(failedCreate, fail...)
-				} else {
-					failedModify = append(failedModify, fail...)
-				}
+				_, msg, _ := strings.Cut(fail[0], ": ")
+				r.Status, r.ErrorKind, r.Error = StatusFailed, ErrKindIO, msg
+			} else {
+				r.Added, r.Removed = lineDelta(oldLines, action.Change.Content)
+			}
+			st.results = append(st.results, r)
+			if len(fail) > 0 {
+				st.failedWrites = append(st.failedWrites, fail...)
 			} else if len(upd) > 0 {
 				if isCreate {
-					created = append(created, upd...)
+					st.created = append(st.created, upd...)
 				} else {
-					modified = append(modified, upd...)
+					st.modified = append(st.modified, upd...)
 				}
 			}
 
 		case "rename":
 			r := action.Rename
-			a.backupFileState(r.OldPath, oldHashes)
+			a.backupFileState(r.OldPath, st.oldHashes)
 			if err := os.Rename(r.OldPath, r.NewPath); err == nil {
-				renamedMap[r.OldPath] = r.NewPath
-				renamedSuccess = append(renamedSuccess, r.OldPath)
+				st.renamedMap[r.OldPath] = r.NewPath
+				st.renamed = append(st.renamed, r.OldPath)
+				st.results = append(st.results, FileResult{Path: r.OldPath, NewPath: r.NewPath, Action: "rename", Status: StatusApplied})
 			} else {
-				failedRenames = append(failedRenames, fmt.Sprintf("%s -> %s: %v", r.OldPath, r.NewPath, err))
+				st.failedRenames = append(st.failedRenames, fmt.Sprintf("%s -> %s: %v", r.OldPath, r.NewPath, err))
+				fr := failedResult(r.OldPath, "rename", err)
+				fr.NewPath = r.NewPath
+				st.results = append(st.results, fr)
 			}
 
 		case "delete":
 			p := action.Path
-			a.backupFileState(p, oldHashes)
+			a.backupFileState(p, st.oldHashes)
+			removed := len(readLines(p))
 			if err := TrashFile(p, trash, a.stateManager.ProjectRoot); err == nil {
-				deleted = append(deleted, p)
+				st.deleted = append(st.deleted, p)
+				st.results = append(st.results, FileResult{Path: p, Action: "delete", Status: StatusApplied, Removed: removed})
 			} else {
-				failedDeletes = append(failedDeletes, fmt.Sprintf("%s: %v", p, err))
+				st.failedDeletes = append(st.failedDeletes, fmt.Sprintf("%s: %v", p, err))
+				st.results = append(st.results, failedResult(p, "delete", err))
 			}
 		}
 		progress()
 	}
+}
 
-	a.recordHistory(created, modified, deleted, renamedSuccess, renamedMap, plan, oldHashes)
+func (a *App) finishApply(plan *ExecutionPlan, st *applyState) (Summary, error) {
+	st.dedupe()
+	warnings := append(plan.Warnings, a.runFormatters(append(append([]string{}, st.created...), st.modified...))...)
+	if err := a.recordHistory(st.created, st.modified, st.deleted, st.renamed, st.renamedMap, plan, st.oldHashes); err != nil {
+		warnings = append(warnings, fmt.Sprintf("failed to record the changes in the undo history: %v", err))
+	}
 
-	return a.createSummary(
-		created,
-		modified,
-		deleted,
-		renamedMap,
-		append(failedCreate, failedModify...),
-		failedDeletes,
-		failedRenames,
+	s, err := a.createSummary(
+		st.created,
+		st.modified,
+		st.deleted,
+		st.renamedMap,
+		st.failedWrites,
+		st.failedDeletes,
+		st.failedRenames,
 		plan.Failed,
+		plan.Stale,
+		warnings,
 	)
+	s.Results = a.relativizeResults(append(append([]FileResult{}, plan.Results...), st.results...))
+	return s, err
 }
 
-func (a *App) recordHistory(created, modified, deleted, renamed []string, renamedMap map[string]string, plan *ExecutionPlan, oldHashes map[string]string) {
+func (a *App) recordHistory(created, modified, deleted, renamed []string, renamedMap map[string]string, plan *ExecutionPlan, oldHashes map[string]string) error {
 	successCount := len(created) + len(modified) + len(deleted) + len(renamed)
 	if successCount == 0 {
-		return
+		return nil
 	}
 
 	var renamesList []FileRename
@@ -196,7 +357,7 @@ func (a *App) recordHistory(created, modified, deleted, renamed []string, rename
 	historyPaths = append(historyPaths, renamed...)
 
 	ops := a.stateManager.CreateOperations(historyPaths, plan.FileActions, renamesList, oldHashes)
-	a.stateManager.Write(ops)
+	return a.stateManager.Write(HistoryEntry{Operations: ops, SessionID: a.cfg.SessionID, MessageIndex: a.cfg.MessageIndex})
 }
 
 func (a *App) backupFileState(path string, hashes map[string]string) {
@@ -205,20 +366,28 @@ func (a *App) backupFileState(path string, hashes map[string]string) {
 	}
 	h, _ := GetFileSHA256(path)
 	hashes[path] = h
-	if h != "" {
+	if h != "" && canBackup(path) {
 		if content, err := os.ReadFile(path); err == nil {
 			_ = WriteBlob(a.stateManager.StateDir, h, content)
 		}
 	}
 }
 
+// reportStateProblems adds what loading the history found wrong with the
+// state file to the summary's warnings.
+func (a *App) reportStateProblems(s *Summary) {
+	if problems := a.stateManager.TakeProblems(); len(problems) > 0 {
+		s.Warnings = append(problems, s.Warnings...)
+	}
+}
+
 func (a *App) reportProgress(current, total int) {
 	if a.progressCallback != nil {
 		a.progressCallback(current, total)
 	}
 }
 
-func (a *App) createSummary(created, modified, deleted []string, renamed map[string]string, failedWrites, failedDeletes, failedRenames, failedPlan []string) (Summary, error) {
+func (a *App) createSummary(created, modified, deleted []string, renamed map[string]string, failedWrites, failedDeletes, failedRenames, failedPlan, stale, warnings []string) (Summary, error) {
 	var renamedPaths []string
 	for oldPath, newPath := range renamed {
 		renamedPaths = append(renamedPaths, fmt.Sprintf("%s -> %s", oldPath, newPath))
@@ -231,33 +400,109 @@ func (a *App) createSummary(created, modified, deleted []string, renamed map[str
 		Deleted:  deleted,
 		Renamed:  renamedPaths,
 		Failed:   allFailed,
+		Stale:    stale,
+		Warnings: warnings,
 	}
 	a.relativizeSummaryPaths(&s)
 	return s, nil
 }
 
 func (a *App) undoLastOperation() (Summary, error) {
-	ops := a.stateManager.GetOperationsToUndo()
+	unlock, err := a.stateManager.Lock()
+	if err != nil {
+		return Summary{}, err
+	}
+	defer unlock()
+
+	ops, err := a.stateManager.GetOperationsToUndo()
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to save history: %w", err)
+	}
 	if len(ops) == 0 {
 		return Summary{Message: "No undo"}, nil
 	}
 	s := a.fileManager.Undo(ops, a.stateManager.StateDir, a.stateManager.ProjectRoot)
 	s.Message = "Undone"
 	a.relativizeSummaryPaths(&s)
+	s.Results = a.relativizeResults(s.Results)
+	return s, nil
+}
+
+func (a *App) undoSessionOperation() (Summary, error) {
+	unlock, err := a.stateManager.Lock()
+	if err != nil {
+		return Summary{}, err
+	}
+	defer unlock()
+
+	idx := a.stateManager.FindEntry(a.cfg.SessionID, a.cfg.MessageIndex)
+	if idx < 0 {
+		return Summary{Message: "No undo"}, nil
+	}
+
+	var warnings []string
+	for _, p := range a.stateManager.LaterPaths(idx) {
+		warnings = append(warnings, fmt.Sprintf("%s: changed again by a later apply", p))
+	}
+
+	ops := a.stateManager.GetOperationsToUndoAt(idx)
+	s := a.fileManager.Undo(ops, a.stateManager.StateDir, a.stateManager.ProjectRoot)
+	if len(s.Failed) > 0 {
+		// The entry stays so the undo can be retried once the failures are
+		// resolved.
+		s.Message = "Undo incomplete"
+	} else if err := a.stateManager.RemoveUndone(idx); err != nil {
+		return Summary{}, err
+	} else {
+		s.Message = "Undone"
+	}
+	s.Warnings = warnings
+	a.relativizeSummaryPaths(&s)
+	s.Results = a.relativizeResults(s.Results)
 	return s, nil
 }
 
 func (a *App) redoLastOperation() (Summary, error) {
-	ops := a.stateManager.GetOperationsToRedo()
+	unlock, err := a.stateManager.Lock()
+	if err != nil {
+		return Summary{}, err
+	}
+	defer unlock()
+
+	ops, err := a.stateManager.GetOperationsToRedo()
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to save history: %w", err)
+	}
 	if len(ops) == 0 {
 		return Summary{Message: "No redo"}, nil
 	}
 	s := a.fileManager.Redo(ops, a.stateManager.StateDir, a.stateManager.ProjectRoot)
 	s.Message = "Redone"
 	a.relativizeSummaryPaths(&s)
+	s.Results = a.relativizeResults(s.Results)
 	return s, nil
 }
 
+func (a *App) relativizeResults(results []FileResult) []FileResult {
+	wd, _ := os.Getwd()
+	relPath := func(p string) string {
+		if r, err := filepath.Rel(wd, p); err == nil {
+			return r
+		}
+		return p
+	}
+
+	out := make([]FileResult, len(results))
+	for i, r := range results {
+		r.Path = relPath(r.Path)
+		if r.NewPath != "" {
+			r.NewPath = relPath(r.NewPath)
+		}
+		out[i] = r
+	}
+	return out
+}
+
 func (a *App) relativizeSummaryPaths(s *Summary) {
 	wd, _ := os.Getwd()
 	relPath := func(p string) string {
@@ -294,4 +539,6 @@ func (a *App) relativizeSummaryPaths(s *Summary) {
 	s.Deleted = relList(s.Deleted)
 	s.Renamed = relList(s.Renamed)
 	s.Failed = relList(s.Failed)
+	s.Stale = relList(s.Stale)
+	s.Warnings = relList(s.Warnings)
 }
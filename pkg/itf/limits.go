@@ -0,0 +1,75 @@
+package itf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sokinpui/coder/pkg/sf"
+)
+
+const (
+	// maxOverwriteSize is the largest existing file a whole-file block may
+	// replace. Bigger files are usually generated and only diffs may edit them.
+	maxOverwriteSize = 1 << 20
+	// maxBlobSize is the largest file backed up for undo.
+	maxBlobSize = 16 << 20
+	// binarySniffLen is how much of a file is inspected for NUL bytes.
+	binarySniffLen = 8000
+)
+
+// checkLimits refuses binary targets, whole-file overwrites of large files
+// and changes to files too large to back up, unless AllowLarge is set. The
+// returned warning notes a file that will be changed without a backup.
+// Deletes are not limited: the deleted file is moved to the trash whatever
+// its size, and undo restores it from there.
+func (p *WritePolicy) checkLimits(a PlannedAction) (kind string, warning string, err error) {
+	if a.Type != "write" {
+		return "", "", nil
+	}
+	path := a.Change.Path
+	overwrite := a.Change.Source != "diff"
+
+	info, statErr := os.Stat(path)
+	if statErr != nil || !info.Mode().IsRegular() {
+		return "", "", nil
+	}
+	size := info.Size()
+
+	if p.AllowLarge {
+		if size > maxBlobSize {
+			return "", fmt.Sprintf("%s: larger than %s, not backed up; undo is unavailable", path, sf.FormatSize(maxBlobSize)), nil
+		}
+		return "", "", nil
+	}
+
+	if a.Type == "write" && isBinaryFile(path) {
+		return ErrKindBinary, "", fmt.Errorf("refusing to write binary file; use --allow-large to write it anyway")
+	}
+	if size > maxBlobSize {
+		return ErrKindTooLarge, "", fmt.Errorf("file is %s, larger than the %s backup limit; use --allow-large to change it without undo", sf.FormatSize(size), sf.FormatSize(maxBlobSize))
+	}
+	if overwrite && size > maxOverwriteSize {
+		return ErrKindTooLarge, "", fmt.Errorf("refusing to overwrite a %s file with a whole-file block; send a diff or use --allow-large", sf.FormatSize(size))
+	}
+	return "", "", nil
+}
+
+func isBinaryFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, _ := io.ReadFull(f, buf)
+	return bytes.IndexByte(buf[:n], 0) != -1
+}
+
+// canBackup reports whether a file is small enough to be stored as a blob.
+func canBackup(path string) bool {
+	info, err := os.Stat(path)
+	return err != nil || info.Size() <= maxBlobSize
+}
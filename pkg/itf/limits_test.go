@@ -0,0 +1,64 @@
+package itf
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLimitsCheckedBeforePatching(t *testing.T) {
+	t.Chdir(t.TempDir())
+	// A binary file whose diff would otherwise fail to match.
+	if err := os.WriteFile("a.bin", []byte("one\x00\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := NewPathResolver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewWritePolicy(resolver.root, nil, nil, resolver)
+
+	plan, err := CreatePlan("```diff\n--- a/a.bin\n+++ b/a.bin\n@@ -1 +1 @@\n-missing\n+x\n```\n", resolver, nil, nil, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Results) != 1 || plan.Results[0].ErrorKind != ErrKindBinary {
+		t.Fatalf("results = %+v, want a binary refusal", plan.Results)
+	}
+}
+
+func TestLargeDeleteIsAllowed(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f, err := os.Create("big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(maxBlobSize + 1); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s, err := ApplySummary("```delete\nbig.txt\n```\n", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Deleted) != 1 || len(s.Failed) > 0 {
+		t.Fatalf("deleted %v, failed %v", s.Deleted, s.Failed)
+	}
+	for _, w := range s.Warnings {
+		if strings.Contains(w, "undo") {
+			t.Errorf("unexpected warning %q", w)
+		}
+	}
+
+	app, err := NewApp(&Config{Undo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err = app.Execute(); err != nil || len(s.Created) != 1 {
+		t.Fatalf("undo: created %v, failed %v, err %v", s.Created, s.Failed, err)
+	}
+	if info, err := os.Stat("big.txt"); err != nil || info.Size() != maxBlobSize+1 {
+		t.Errorf("big.txt not restored: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package itf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lockFileName = "lock"
+	lockTimeout  = 3 * time.Second
+	lockPoll     = 50 * time.Millisecond
+)
+
+var ErrLocked = errors.New("another itf operation is in progress")
+
+// Lock takes the cross-process lock on the state directory, waiting a few
+// seconds for another operation to finish, and reloads the history, which
+// another process may have changed. The returned function releases the lock.
+func (m *StateManager) Lock() (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		unlock, err := m.TryLock()
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return unlock, err
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// TryLock is Lock without waiting: it fails with ErrLocked at once when
+// another operation holds the lock.
+//
+// The lock is an advisory lock on an open lock file, so the system releases
+// it when its owner exits and a crashed process never leaves it behind. The
+// file itself is never removed, since a process could otherwise lock a file
+// another one is about to replace.
+func (m *StateManager) TryLock() (func(), error) {
+	path := filepath.Join(m.StateDir, lockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	locked, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	if !locked {
+		pid := lockOwner(f)
+		f.Close()
+		if pid > 0 {
+			return nil, fmt.Errorf("%w (pid %d, lock file %s)", ErrLocked, pid, path)
+		}
+		return nil, fmt.Errorf("%w (lock file %s)", ErrLocked, path)
+	}
+
+	// The owner's pid only makes the error above more helpful.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	unlock := func() {
+		unlockFile(f)
+		f.Close()
+	}
+	if err := m.reload(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func (m *StateManager) reload() error {
+	m.state = &State{CurrentIndex: -1, History: []HistoryEntry{}}
+	return m.load()
+}
+
+// lockOwner returns the pid written by the process holding the lock, or 0.
+func lockOwner(f *os.File) int {
+	data := make([]byte, 32)
+	n, _ := f.ReadAt(data, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	return pid
+}
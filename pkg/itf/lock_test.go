@@ -0,0 +1,29 @@
+package itf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTryLock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	m, err := NewStateManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := m.TryLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.TryLock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second TryLock: err = %v, want ErrLocked", err)
+	}
+	unlock()
+
+	unlock, err = m.TryLock()
+	if err != nil {
+		t.Fatalf("TryLock after unlock: %v", err)
+	}
+	unlock()
+}
@@ -22,6 +22,8 @@ type PlannedAction struct {
 	Change *FileChange
 	Rename *FileRename
 	Path   string // For delete
+	// admitted is set when the write policy already accepted the action.
+	admitted bool
 }
 
 type Summary struct {
@@ -30,5 +32,8 @@ type Summary struct {
 	Renamed  []string
 	Deleted  []string
 	Failed   []string
+	Stale    []string
+	Warnings []string
 	Message  string
+	Results  []FileResult
 }
@@ -12,21 +12,27 @@ type ExecutionPlan struct {
 	FileActions  map[string]string
 	DirsToCreate map[string]struct{}
 	Failed       []string
+	Stale        []string
+	Warnings     []string
+	Results      []FileResult
 }
 
-func CreatePlan(content string, resolver *PathResolver, extensions []string, files []string) (*ExecutionPlan, error) {
-	allowedFiles := make(map[string]struct{})
-	for _, f := range files {
-		allowedFiles[resolver.Resolve(f)] = struct{}{}
-	}
-
+func CreatePlan(content string, resolver *PathResolver, extensions []string, files []string, policy *WritePolicy) (*ExecutionPlan, error) {
 	allBlocks, err := ExtractCodeBlocks([]byte(content))
 	if err != nil {
 		return nil, err
 	}
+	return createPlanFromBlocks(allBlocks, resolver, extensions, files, policy), nil
+}
+
+func createPlanFromBlocks(allBlocks []CodeBlock, resolver *PathResolver, extensions []string, files []string, policy *WritePolicy) *ExecutionPlan {
+	allowedFiles := make(map[string]struct{})
+	for _, f := range files {
+		allowedFiles[resolver.Resolve(f)] = struct{}{}
+	}
 
+	plan := &ExecutionPlan{}
 	var actions []PlannedAction
-	var failed []string
 
 	// Track renames as we go to resolve diff sources correctly
 	renameDestSet := make(map[string]struct{})
@@ -64,22 +70,40 @@ func CreatePlan(content string, resolver *PathResolver, extensions []string, fil
 			sourcePath := abs
 			if s, ok := renameDestToSource[abs]; ok {
 				sourcePath = s
+			} else if !fileExists(abs) && editsExistingFile(raw) {
+				resolved, candidates, err := resolver.correctDiffPath(path, raw)
+				if err != nil {
+					r := failedResult(abs, "modify", err)
+					r.ErrorKind = ErrKindUnknownPath
+					r.Candidates = candidates
+					plan.fail(r)
+					continue
+				}
+				if resolved != "" {
+					if !isAllowed(resolved, allowedFiles) {
+						continue
+					}
+					plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: resolved to %s", abs, resolver.relative(resolved)))
+					abs, sourcePath = resolved, resolved
+				}
 			}
 
+			// Check the target before reading and patching it, which is
+			// the costly part for files the limits refuse.
+			change := &FileChange{Path: abs, Source: "diff", RawBlock: fmt.Sprintf("```diff\n%s\n```", raw)}
+			if !policy.admit(PlannedAction{Type: "write", Change: change}, plan) {
+				continue
+			}
 			applied, err := ApplyDiffToPath(sourcePath, raw)
 			if err != nil {
-				failed = append(failed, fmt.Sprintf("%s: %v", abs, err))
+				plan.fail(failedResult(abs, writeAction(sourcePath), err))
+				continue
+			}
+			change.Content = applied
+			if !policy.admitContent(change, plan) {
 				continue
 			}
-			actions = append(actions, PlannedAction{
-				Type: "write",
-				Change: &FileChange{
-					Path:     abs,
-					Content:  applied,
-					Source:   "diff",
-					RawBlock: fmt.Sprintf("```diff\n%s\n```", raw),
-				},
-			})
+			actions = append(actions, PlannedAction{Type: "write", Change: change, admitted: true})
 		default:
 			if len(extensions) == 1 && extensions[0] == ".diff" {
 				continue
@@ -91,6 +115,8 @@ func CreatePlan(content string, resolver *PathResolver, extensions []string, fil
 		}
 	}
 
+	actions = policy.filter(actions, plan)
+
 	targetPaths := collectTargetPaths(actions)
 	fileActions, dirs := GetFileActionsAndDirs(targetPaths, renameDestSet)
 
@@ -103,12 +129,10 @@ func CreatePlan(content string, resolver *PathResolver, extensions []string, fil
 		}
 	}
 
-	return &ExecutionPlan{
-		Actions:      actions,
-		FileActions:  fileActions,
-		DirsToCreate: dirs,
-		Failed:       failed,
-	}, nil
+	plan.Actions = actions
+	plan.FileActions = fileActions
+	plan.DirsToCreate = dirs
+	return plan
 }
 
 func parseFileBlock(b CodeBlock, resolver *PathResolver, extensions []string, allowed map[string]struct{}) *FileChange {
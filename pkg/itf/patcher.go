@@ -1,6 +1,7 @@
 package itf
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
@@ -18,6 +19,7 @@ func ExtractPathFromDiff(content string) string {
 }
 
 type diffHunk struct {
+	raw         []string
 	target      []string
 	replacement []string
 	deletedOnly []string
@@ -39,9 +41,7 @@ func ApplyDiffToPath(sourcePath, rawDiff string) ([]string, error) {
 		if err != nil && !os.IsNotExist(err) {
 			return nil, fmt.Errorf("failed to read source file: %w", err)
 		}
-		if len(content) > 0 {
-			sourceLines = strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n"), "\n")
-		}
+		sourceLines = decodeLines(content)
 	}
 	return ApplyDiff(sourceLines, rawDiff)
 }
@@ -49,7 +49,7 @@ func ApplyDiffToPath(sourcePath, rawDiff string) ([]string, error) {
 func ApplyDiff(sourceLines []string, rawDiff string) ([]string, error) {
 	hunks := parseDiffHunks(rawDiff)
 	if len(hunks) == 0 {
-		return nil, fmt.Errorf("no valid diff hunks found")
+		return nil, &HunkError{Kind: ErrKindInvalidDiff, Err: fmt.Errorf("no valid diff hunks found")}
 	}
 
 	var patches []hunkPatch
@@ -59,9 +59,14 @@ func ApplyDiff(sourceLines []string, rawDiff string) ([]string, error) {
 		startIdx, endIdx := matchHunk(sourceLines, h, searchStart)
 		if startIdx == -1 {
 			if isAlreadyApplied(sourceLines, h, searchStart) {
-				return nil, fmt.Errorf("hunk #%d already applied (added lines are already present in file)", i+1)
+				return nil, &HunkError{Kind: ErrKindAlreadyApplied, Hunk: i + 1, Err: fmt.Errorf("hunk #%d already applied (added lines are already present in file)", i+1)}
+			}
+			diag := diagnoseHunk(sourceLines, h, searchStart)
+			msg := fmt.Sprintf("failed to match hunk #%d near %s", i+1, hunkPreview(h.target))
+			if diag.Line > 0 {
+				msg += fmt.Sprintf("; closest match at line %d (%.0f%% similar)", diag.Line, diag.Score*100)
 			}
-			return nil, fmt.Errorf("failed to match hunk #%d near %s", i+1, hunkPreview(h.target))
+			return nil, &HunkError{Kind: ErrKindHunkMismatch, Hunk: i + 1, Err: errors.New(msg), Diagnostic: diag}
 		}
 		patches = append(patches, hunkPatch{
 			startIdx:    startIdx,
@@ -80,7 +85,7 @@ func ApplyDiff(sourceLines []string, rawDiff string) ([]string, error) {
 
 	for _, p := range patches {
 		if p.startIdx > len(result) || p.endIdx > len(result) || p.startIdx > p.endIdx {
-			return nil, fmt.Errorf("invalid patch bounds [%d:%d] for length %d", p.startIdx, p.endIdx, len(result))
+			return nil, &HunkError{Kind: ErrKindInvalidDiff, Err: fmt.Errorf("invalid patch bounds [%d:%d] for length %d", p.startIdx, p.endIdx, len(result))}
 		}
 		result = append(result[:p.startIdx], append(p.replacement, result[p.endIdx:]...)...)
 	}
@@ -131,6 +136,7 @@ func parseDiffHunks(raw string) []diffHunk {
 
 func buildDiffHunk(lines []string) (diffHunk, bool) {
 	var h diffHunk
+	h.raw = lines
 	h.delOffset = -1
 	var currentDel []string
 
@@ -270,9 +276,19 @@ func extractAnchor(lines []string, count int, fromEnd bool) []string {
 }
 
 func matchFuzzyWindow(source, target []string, searchStart int) (int, int) {
-	if len(source) == 0 || len(target) == 0 {
+	start, end, score := bestFuzzyWindow(source, target, searchStart)
+	if score < 0.70 {
 		return -1, -1
 	}
+	return start, end
+}
+
+// bestFuzzyWindow returns the window of source, a few lines shorter or longer
+// than target, that scores highest against it.
+func bestFuzzyWindow(source, target []string, searchStart int) (int, int, float64) {
+	if len(source) == 0 || len(target) == 0 {
+		return -1, -1, 0
+	}
 
 	targetLen := len(target)
 	bestScore := 0.0
@@ -290,7 +306,7 @@ func matchFuzzyWindow(source, target []string, searchStart int) (int, int) {
 			}
 			window := source[i : i+w]
 			score := similarityScore(window, target)
-			if score > bestScore && score >= 0.70 {
+			if score > bestScore {
 				bestScore = score
 				bestStart = i
 				bestEnd = i + w
@@ -298,7 +314,7 @@ func matchFuzzyWindow(source, target []string, searchStart int) (int, int) {
 		}
 	}
 
-	return bestStart, bestEnd
+	return bestStart, bestEnd, bestScore
 }
 
 func matchDeletedSegments(source []string, h diffHunk, searchStart int) (int, int) {
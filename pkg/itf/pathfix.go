@@ -0,0 +1,110 @@
+package itf
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sokinpui/coder/pkg/sf"
+)
+
+// maxPathCandidates bounds the candidates listed when a path is ambiguous.
+const maxPathCandidates = 5
+
+// PathCandidates lists project files the model may have meant by a path that
+// does not exist: files whose path ends with it, or failing that, files with
+// the same base name.
+func (r *PathResolver) PathCandidates(requested string) []string {
+	if r.projectFiles == nil {
+		r.projectFiles = sf.Run([]string{r.root}, "file", nil, false)
+	}
+
+	want := path.Clean(filepath.ToSlash(requested))
+	want = strings.TrimPrefix(want, "./")
+	base := path.Base(want)
+
+	var suffix, sameBase []string
+	for _, f := range r.projectFiles {
+		rel, ok := relativeTo(r.root, f)
+		if !ok || path.Base(rel) != base {
+			continue
+		}
+		if strings.HasSuffix("/"+rel, "/"+want) {
+			suffix = append(suffix, f)
+			continue
+		}
+		sameBase = append(sameBase, f)
+	}
+	if len(suffix) > 0 {
+		return suffix
+	}
+	return sameBase
+}
+
+// correctDiffPath finds the file a diff aimed at a missing path was meant for.
+// It returns the candidate when exactly one of them accepts every hunk, and
+// an error listing the candidates when the choice is ambiguous or none fits.
+// It returns "" and no error when the project has no similar file.
+func (r *PathResolver) correctDiffPath(requested, rawDiff string) (string, []string, error) {
+	candidates := r.PathCandidates(requested)
+	if len(candidates) == 0 {
+		return "", nil, nil
+	}
+
+	var matching []string
+	for _, c := range candidates {
+		// Guessing is not worth reading large or binary files in full.
+		if info, err := os.Stat(c); err != nil || info.Size() > maxOverwriteSize || isBinaryFile(c) {
+			continue
+		}
+		if _, err := ApplyDiffToPath(c, rawDiff); err == nil {
+			matching = append(matching, c)
+		}
+	}
+	if len(matching) == 1 {
+		return matching[0], nil, nil
+	}
+
+	listed := candidates
+	if len(matching) > 1 {
+		listed = matching
+	}
+	if len(listed) > maxPathCandidates {
+		listed = listed[:maxPathCandidates]
+	}
+	rels := make([]string, len(listed))
+	for i, c := range listed {
+		rels[i] = r.relative(c)
+	}
+
+	reason := "no candidate matches the hunks"
+	if len(matching) > 1 {
+		reason = "several candidates match the hunks"
+	}
+	return "", rels, fmt.Errorf("file does not exist and %s; did you mean %s", reason, strings.Join(rels, ", "))
+}
+
+// editsExistingFile reports whether a diff modifies a file rather than
+// creating one, i.e. it has a hunk with context or removed lines.
+func editsExistingFile(rawDiff string) bool {
+	for _, h := range parseDiffHunks(rawDiff) {
+		if len(h.target) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PathResolver) relative(p string) string {
+	if rel, err := filepath.Rel(r.wd, p); err == nil {
+		return rel
+	}
+	return p
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,75 @@
+package itf
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDiffPathCorrection(t *testing.T) {
+	const diff = "```diff\n--- a/b.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n```\n"
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		// fixed is the file the diff is applied to, or "" when it fails.
+		fixed      string
+		candidates []string
+	}{
+		{
+			name:  "unique match",
+			files: map[string]string{"x/b.go": "one\ntwo\n", "y/b.go": "other\n"},
+			fixed: "x/b.go",
+		},
+		{
+			name:       "ambiguous match",
+			files:      map[string]string{"x/b.go": "one\ntwo\n", "y/b.go": "one\ntwo\n"},
+			candidates: []string{"x/b.go", "y/b.go"},
+		},
+		{
+			name:       "no match",
+			files:      map[string]string{"x/b.go": "other\n"},
+			candidates: []string{"x/b.go"},
+		},
+		{
+			name:  "binary candidate is skipped",
+			files: map[string]string{"x/b.go": "one\ntwo\n\x00\n", "y/b.go": "one\ntwo\n"},
+			fixed: "y/b.go",
+		},
+	}
+	for _, tt := range tests {
+		t.Chdir(t.TempDir())
+		for name, content := range tt.files {
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		sum, err := ApplySummary(diff, Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat("b.go"); err == nil {
+			t.Errorf("%s: b.go was created", tt.name)
+		}
+		if tt.fixed != "" {
+			if len(sum.Failed) > 0 {
+				t.Fatalf("%s: failed %+v", tt.name, sum.Results)
+			}
+			if got, _ := os.ReadFile(tt.fixed); string(got) != "one\nTWO\n" {
+				t.Errorf("%s: %s = %q", tt.name, tt.fixed, got)
+			}
+			continue
+		}
+		if len(sum.Results) != 1 || sum.Results[0].ErrorKind != ErrKindUnknownPath {
+			t.Fatalf("%s: results = %+v, want an unknown path", tt.name, sum.Results)
+		}
+		if got := sum.Results[0].Candidates; !slices.Equal(got, tt.candidates) {
+			t.Errorf("%s: candidates %q, want %q", tt.name, got, tt.candidates)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package itf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var reservedDirs = []string{".git", stateDirName, ".coder"}
+
+// WritePolicy decides which paths a plan may touch. Paths outside Root, inside
+// the reserved directories or matching a Protected glob are rejected unless
+// they are listed in Allow. Binary and oversized targets are rejected unless
+// AllowLarge is set. Writes adding a match of Placeholder are rejected.
+type WritePolicy struct {
+	Root        string
+	Protected   []string
+	Allow       map[string]struct{}
+	AllowLarge  bool
+	Placeholder *regexp.Regexp
+}
+
+func NewWritePolicy(root string, protected, allow []string, resolver *PathResolver) *WritePolicy {
+	p := &WritePolicy{Root: root, Protected: protected, Allow: make(map[string]struct{})}
+	for _, a := range allow {
+		p.Allow[resolver.Resolve(a)] = struct{}{}
+	}
+	return p
+}
+
+func (p *WritePolicy) Check(path string) error {
+	if p == nil {
+		return nil
+	}
+	if _, ok := p.Allow[path]; ok {
+		return nil
+	}
+
+	rel, ok := relativeTo(p.Root, path)
+	if !ok {
+		return fmt.Errorf("blocked by write policy: outside the project root")
+	}
+	root := p.Root
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r
+	}
+	if _, ok := relativeTo(root, realPath(path)); !ok {
+		return fmt.Errorf("blocked by write policy: symlink points outside the project root")
+	}
+
+	first, _, _ := strings.Cut(rel, "/")
+	for _, dir := range reservedDirs {
+		if first == dir {
+			return fmt.Errorf("blocked by write policy: inside %s", dir)
+		}
+	}
+
+	for _, pattern := range p.Protected {
+		if matchGlob(pattern, rel) {
+			return fmt.Errorf("blocked by write policy: matches protected pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+func (p *WritePolicy) filter(actions []PlannedAction, plan *ExecutionPlan) []PlannedAction {
+	var kept []PlannedAction
+	for _, a := range actions {
+		if a.admitted || p.admit(a, plan) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// admit checks an action against the policy and the size limits, recording a
+// refusal or warning in plan. It only stats and sniffs the files, so diffs
+// are checked with it before their target is read.
+func (p *WritePolicy) admit(a PlannedAction, plan *ExecutionPlan) bool {
+	var paths []string
+	action := a.Type
+	switch a.Type {
+	case "write":
+		paths = []string{a.Change.Path}
+		action = writeAction(a.Change.Path)
+	case "rename":
+		paths = []string{a.Rename.OldPath, a.Rename.NewPath}
+	case "delete":
+		paths = []string{a.Path}
+	}
+
+	for _, path := range paths {
+		if err := p.Check(path); err != nil {
+			r := failedResult(path, action, err)
+			r.ErrorKind = ErrKindPolicy
+			plan.fail(r)
+			return false
+		}
+	}
+
+	if p != nil {
+		kind, warning, err := p.checkLimits(a)
+		if err != nil {
+			r := failedResult(paths[0], action, err)
+			r.ErrorKind = kind
+			plan.fail(r)
+			return false
+		}
+		if warning != "" {
+			plan.Warnings = append(plan.Warnings, warning)
+		}
+	}
+	if a.Type == "write" && a.Change.Content != nil {
+		return p.admitContent(a.Change, plan)
+	}
+	return true
+}
+
+// admitContent refuses a change that adds a placeholder, such as a redacted
+// secret the model only saw as a placeholder, which would replace the real
+// value on disk. Placeholders already in the file may stay.
+func (p *WritePolicy) admitContent(c *FileChange, plan *ExecutionPlan) bool {
+	if p == nil || p.Placeholder == nil {
+		return true
+	}
+	matches := p.Placeholder.FindAllString(strings.Join(c.Content, "\n"), -1)
+	if len(matches) == 0 {
+		return true
+	}
+
+	old, _ := os.ReadFile(c.Path)
+	for _, m := range matches {
+		if !bytes.Contains(old, []byte(m)) {
+			r := failedResult(c.Path, writeAction(c.Path), fmt.Errorf("refusing to write %s, a placeholder with no known value", m))
+			r.ErrorKind = ErrKindPlaceholder
+			plan.fail(r)
+			return false
+		}
+	}
+	return true
+}
+
+func relativeTo(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || filepath.IsAbs(rel) {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// realPath resolves the symlinks in path, including those of directories
+// above it, so that a file under a symlinked directory is checked where it
+// really is. The part below the deepest existing ancestor is kept as is.
+func realPath(path string) string {
+	path = resolveSymlink(path)
+	dir, rest := path, ""
+	for {
+		if r, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(r, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+// matchGlob matches a slash separated path against a glob where "**" spans any
+// number of directories. Patterns without a slash match the base name.
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
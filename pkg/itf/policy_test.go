@@ -0,0 +1,142 @@
+package itf
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestWritePolicyCheck(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"link":   outside,
+		"inlink": filepath.Join(root, "sub"),
+		"out.go": filepath.Join(outside, "x.go"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	p := &WritePolicy{
+		Root:      root,
+		Protected: []string{"secrets/**", "*.lock"},
+		Allow:     map[string]struct{}{filepath.Join(root, "pkg.lock"): {}},
+	}
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"a.go", true},
+		{"sub/dir/b.go", true},
+		{"inlink/c.go", true},
+		{"pkg.lock", true},
+		{"../x.go", false},
+		{"sub/../../x.go", false},
+		{filepath.Join(outside, "x.go"), false},
+		{".git/config", false},
+		{".itf/states.json", false},
+		{".coder/history/a.md", false},
+		{"secrets/deep/key.txt", false},
+		{"go.lock", false},
+		{"link/evil.go", false},
+		{"link/new/evil.go", false},
+		{"out.go", false},
+	}
+	for _, tt := range tests {
+		path := tt.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		err := p.Check(path)
+		if (err == nil) != tt.ok {
+			t.Errorf("Check(%s) = %v, want ok %v", tt.path, err, tt.ok)
+		}
+	}
+}
+
+var testPlaceholder = regexp.MustCompile(`\[REDACTED:[a-z-]+:[0-9a-f]{8}\]`)
+
+func restoreKey(text string) string {
+	return strings.ReplaceAll(text, "[REDACTED:key:00000000]", "s3cret")
+}
+
+func TestRestoreBeforeApply(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.go", []byte("key := \"s3cret\"\nx := 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := "```diff\n--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,2 @@\n key := \"[REDACTED:key:00000000]\"\n-x := 1\n+x := 2\n```\n"
+	sum, err := ApplySummary(diff, Config{Restore: restoreKey, Placeholder: testPlaceholder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Failed) > 0 {
+		t.Fatalf("failed %v", sum.Failed)
+	}
+	got, _ := os.ReadFile("a.go")
+	if string(got) != "key := \"s3cret\"\nx := 2\n" {
+		t.Errorf("a.go after diff = %q", got)
+	}
+
+	block := "`a.go`\n\n```go\nkey := \"[REDACTED:key:00000000]\"\nx := 3\n```\n"
+	if _, err := ApplySummary(block, Config{Restore: restoreKey, Placeholder: testPlaceholder}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = os.ReadFile("a.go")
+	if string(got) != "key := \"s3cret\"\nx := 3\n" {
+		t.Errorf("a.go after whole-file block = %q", got)
+	}
+}
+
+func TestUnknownPlaceholderIsRefused(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.go", []byte("key := \"s3cret\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	block := "`a.go`\n\n```go\nkey := \"[REDACTED:key:ffffffff]\"\n```\n"
+	sum, err := ApplySummary(block, Config{Restore: restoreKey, Placeholder: testPlaceholder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Results) != 1 || sum.Results[0].ErrorKind != ErrKindPlaceholder {
+		t.Fatalf("results = %+v, want a placeholder refusal", sum.Results)
+	}
+	got, _ := os.ReadFile("a.go")
+	if string(got) != "key := \"s3cret\"\n" {
+		t.Errorf("a.go = %q, want it untouched", got)
+	}
+}
+
+func TestPlaceholderAlreadyInFileIsKept(t *testing.T) {
+	t.Chdir(t.TempDir())
+	doc := "Example: [REDACTED:key:ffffffff]\n"
+	if err := os.WriteFile("doc.md", []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := "```diff\n--- a/doc.md\n+++ b/doc.md\n@@ -1 +1,2 @@\n Example: [REDACTED:key:ffffffff]\n+More.\n```\n"
+	sum, err := ApplySummary(diff, Config{Placeholder: testPlaceholder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.Failed) > 0 {
+		t.Fatalf("failed %v", sum.Failed)
+	}
+	got, _ := os.ReadFile("doc.md")
+	if string(got) != doc+"More.\n" {
+		t.Errorf("doc.md = %q", got)
+	}
+}
@@ -0,0 +1,151 @@
+package itf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	StatusApplied = "applied"
+	StatusFailed  = "failed"
+	StatusStale   = "stale"
+)
+
+const (
+	ErrKindHunkMismatch   = "hunk_mismatch"
+	ErrKindAlreadyApplied = "already_applied"
+	ErrKindInvalidDiff    = "invalid_diff"
+	ErrKindPolicy         = "policy"
+	ErrKindStale          = "stale"
+	ErrKindIO             = "io"
+	ErrKindUnknownPath    = "unknown_path"
+	ErrKindBinary         = "binary"
+	ErrKindTooLarge       = "too_large"
+	ErrKindLocked         = "locked"
+	ErrKindPlaceholder    = "placeholder"
+	ErrKindIncomplete     = "incomplete"
+)
+
+// FileResult is the outcome of a single file operation.
+type FileResult struct {
+	Path      string `json:"path"`
+	NewPath   string `json:"new_path,omitempty"`
+	Action    string `json:"action"`
+	Status    string `json:"status"`
+	ErrorKind string `json:"error_kind,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Hunk      int    `json:"hunk,omitempty"`
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+
+	Diagnostic *HunkDiagnostic `json:"diagnostic,omitempty"`
+	// Candidates lists existing files that a diff for a missing path may
+	// have been meant for.
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// HunkDiagnostic describes the closest region to a hunk that failed to match.
+// Line is 1-based and zero when no candidate was found.
+type HunkDiagnostic struct {
+	Hunk     string   `json:"hunk"`
+	Line     int      `json:"line,omitempty"`
+	EndLine  int      `json:"end_line,omitempty"`
+	Score    float64  `json:"score"`
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual,omitempty"`
+}
+
+// Result is the machine-readable form of a Summary.
+type Result struct {
+	Message  string       `json:"message,omitempty"`
+	Files    []FileResult `json:"files"`
+	Warnings []string     `json:"warnings,omitempty"`
+}
+
+// HunkError reports which hunk of a diff could not be applied.
+type HunkError struct {
+	Kind       string
+	Hunk       int
+	Err        error
+	Diagnostic *HunkDiagnostic
+}
+
+func (e *HunkError) Error() string { return e.Err.Error() }
+func (e *HunkError) Unwrap() error { return e.Err }
+
+func failedResult(path, action string, err error) FileResult {
+	r := FileResult{Path: path, Action: action, Status: StatusFailed, ErrorKind: ErrKindIO, Error: err.Error()}
+	var he *HunkError
+	if errors.As(err, &he) {
+		r.ErrorKind = he.Kind
+		r.Hunk = he.Hunk
+		r.Diagnostic = he.Diagnostic
+	}
+	return r
+}
+
+func writeAction(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return "modify"
+	}
+	return "create"
+}
+
+func (p *ExecutionPlan) fail(r FileResult) {
+	p.Failed = append(p.Failed, fmt.Sprintf("%s: %s", r.Path, r.Error))
+	p.Results = append(p.Results, r)
+}
+
+// lineDelta counts added and removed lines between two versions of a file,
+// ignoring the unchanged prefix and suffix.
+func lineDelta(old, new []string) (added, removed int) {
+	for len(old) > 0 && len(new) > 0 && old[0] == new[0] {
+		old, new = old[1:], new[1:]
+	}
+	for len(old) > 0 && len(new) > 0 && old[len(old)-1] == new[len(new)-1] {
+		old, new = old[:len(old)-1], new[:len(new)-1]
+	}
+
+	counts := make(map[string]int)
+	for _, l := range old {
+		counts[l]++
+	}
+	for _, l := range new {
+		if counts[l] > 0 {
+			counts[l]--
+			continue
+		}
+		added++
+	}
+	for _, c := range counts {
+		removed += c
+	}
+	return added, removed
+}
+
+func readLines(path string) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return decodeLines(content)
+}
+
+// Result converts the summary to its machine-readable form.
+func (s Summary) Result() Result {
+	r := Result{Message: s.Message, Files: s.Results, Warnings: s.Warnings}
+	if r.Files == nil {
+		r.Files = []FileResult{}
+	}
+	return r
+}
+
+func FormatJSON(s Summary) (string, error) {
+	data, err := json.MarshalIndent(s.Result(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -1,25 +1,25 @@
 package itf
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
 
 const (
-	stateDirName   = ".itf"
-	stateFileName  = "states.itf"
-	TrashDir       = "trash"
-	BlobsDir       = "blobs"
-	entrySeparator = "\n===\n"
-	opSeparator    = "\n---\n"
-	none           = "-"
+	stateDirName  = ".itf"
+	stateFileName = "states.json"
+	stateVersion  = 1
+	TrashDir      = "trash"
+	BlobsDir      = "blobs"
 )
 
 type Operation struct {
@@ -31,8 +31,13 @@ type Operation struct {
 	NewPath        string
 }
 
+// HistoryEntry is one apply. SessionID and MessageIndex identify the coder
+// session and the AI message that produced it; both are empty for plain itf
+// runs.
 type HistoryEntry struct {
-	Operations []Operation
+	Operations   []Operation
+	SessionID    string
+	MessageIndex int
 }
 
 type State struct {
@@ -45,6 +50,8 @@ type StateManager struct {
 	state       *State
 	StateDir    string
 	ProjectRoot string
+	// problems holds what the last load found wrong with the state file.
+	problems []string
 }
 
 func findGitRoot() (string, error) {
@@ -61,6 +68,18 @@ func findGitRoot() (string, error) {
 }
 
 func NewStateManager() (*StateManager, error) {
+	m, err := openStateManager()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// openStateManager locates the state directory without reading the history.
+func openStateManager() (*StateManager, error) {
 	root, _ := findGitRoot()
 	dir := filepath.Join(root, stateDirName)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -72,130 +91,233 @@ func NewStateManager() (*StateManager, error) {
 		ProjectRoot: root,
 	}
 	m.state = &State{CurrentIndex: -1, History: []HistoryEntry{}}
-	_ = m.load()
 	return m, nil
 }
 
+// stateFile is the on-disk form of State. Paths are relative to the project
+// root and every entry carries a checksum of its own content.
+type stateFile struct {
+	Version      int          `json:"version"`
+	CurrentIndex int          `json:"current_index"`
+	Entries      []stateEntry `json:"entries"`
+}
+
+type stateEntry struct {
+	SessionID    string           `json:"session,omitempty"`
+	MessageIndex int              `json:"message"`
+	Operations   []stateOperation `json:"operations"`
+	Checksum     string           `json:"checksum"`
+}
+
+type stateOperation struct {
+	Timestamp      int64  `json:"timestamp"`
+	Action         string `json:"action"`
+	Path           string `json:"path"`
+	OldContentHash string `json:"old_hash,omitempty"`
+	ContentHash    string `json:"hash,omitempty"`
+	NewPath        string `json:"new_path,omitempty"`
+}
+
+func (e stateEntry) checksum() string {
+	e.Checksum = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// load reads the state file, migrating a legacy states.itf on first use. A
+// file that cannot be parsed is moved aside so it is not overwritten.
 func (m *StateManager) load() error {
-	file, err := os.Open(m.statePath)
+	data, err := os.ReadFile(m.statePath)
+	if os.IsNotExist(err) {
+		return m.migrateLegacy()
+	}
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	if !scanner.Scan() {
+	state, problems, err := m.decode(data)
+	if errors.Is(err, errNewerState) {
+		return err
+	}
+	if err != nil {
+		if err := os.Rename(m.statePath, m.statePath+".corrupt"); err != nil {
+			return err
+		}
+		m.problems = []string{fmt.Sprintf("%s could not be parsed (%v); moved it to %s.corrupt and started a new history", stateFileName, err, stateFileName)}
 		return nil
 	}
+	m.state = state
+	m.problems = problems
+	if len(problems) > 0 {
+		// The next save drops what decode could not use, so keep the file as
+		// it was.
+		backup, err := m.backup(data)
+		if err != nil {
+			return err
+		}
+		m.problems = append(m.problems, fmt.Sprintf("the original %s was kept as %s", stateFileName, filepath.Base(backup)))
+	}
+	return nil
+}
 
-	idx, _ := strconv.Atoi(strings.TrimSpace(scanner.Text()))
-	m.state = &State{CurrentIndex: idx, History: []HistoryEntry{}}
+// backup copies the state file content to a file named after its hash, so
+// loading the same damaged file again does not pile up copies.
+func (m *StateManager) backup(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	path := fmt.Sprintf("%s.%s.bak", m.statePath, hex.EncodeToString(sum[:4]))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	return path, os.WriteFile(path, data, 0644)
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "===" {
-			m.state.History = append(m.state.History, HistoryEntry{})
-			continue
-		}
+// TakeProblems returns and clears what loading the history found wrong with
+// the state file, such as entries dropped for a bad checksum.
+func (m *StateManager) TakeProblems() []string {
+	problems := m.problems
+	m.problems = nil
+	return problems
+}
 
-		if line == "" || line == "---" || len(m.state.History) == 0 {
-			continue
-		}
+var errNewerState = errors.New("state file was written by a newer itf")
 
-		entry := &m.state.History[len(m.state.History)-1]
-		op := Operation{Timestamp: parseTimestamp(line)}
+// decode parses a state file. Entries from the first one failing its
+// checksum onward are dropped, since later entries build on it; every
+// mismatch is reported in problems.
+func (m *StateManager) decode(data []byte) (*State, []string, error) {
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, nil, err
+	}
+	if f.Version > stateVersion {
+		return nil, nil, fmt.Errorf("%w (version %d, supported %d)", errNewerState, f.Version, stateVersion)
+	}
 
-		fields := []*string{&op.Action, &op.Path, &op.OldContentHash, &op.ContentHash, &op.NewPath}
-		for _, f := range fields {
-			if !scanner.Scan() {
-				break
+	var problems []string
+	state := &State{CurrentIndex: f.CurrentIndex, History: []HistoryEntry{}}
+	for i, e := range f.Entries {
+		if e.checksum() != e.Checksum {
+			problems = append(problems, fmt.Sprintf("entry %d: checksum mismatch", i+1))
+			if i+1 < len(f.Entries) {
+				problems = append(problems, fmt.Sprintf("dropped entries %d-%d of %d from the undo history", i+1, len(f.Entries), len(f.Entries)))
+			} else {
+				problems = append(problems, fmt.Sprintf("dropped entry %d of %d from the undo history", i+1, len(f.Entries)))
 			}
-			*f = strings.TrimSpace(scanner.Text())
+			break
 		}
 
-		op.Action = m.fromStoreValue(op.Action)
-		op.Path = m.resolvePath(op.Path)
-		op.OldContentHash = m.fromStoreValue(op.OldContentHash)
-		op.ContentHash = m.fromStoreValue(op.ContentHash)
-		op.NewPath = m.resolvePath(op.NewPath)
-
-		entry.Operations = append(entry.Operations, op)
+		entry := HistoryEntry{SessionID: e.SessionID, MessageIndex: e.MessageIndex}
+		for _, op := range e.Operations {
+			entry.Operations = append(entry.Operations, Operation{
+				Timestamp:      op.Timestamp,
+				Action:         op.Action,
+				Path:           m.resolvePath(op.Path),
+				OldContentHash: op.OldContentHash,
+				ContentHash:    op.ContentHash,
+				NewPath:        m.resolvePath(op.NewPath),
+			})
+		}
+		state.History = append(state.History, entry)
 	}
-	return scanner.Err()
-}
 
-func parseTimestamp(s string) int64 {
-	ts, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
-	return ts
+	if state.CurrentIndex >= len(state.History) || state.CurrentIndex < -1 {
+		problems = append(problems, fmt.Sprintf("current index %d is out of range", state.CurrentIndex))
+		state.CurrentIndex = len(state.History) - 1
+	}
+	return state, problems, nil
 }
 
-func (m *StateManager) save() {
-	file, err := os.Create(m.statePath)
+func (m *StateManager) migrateLegacy() error {
+	legacyPath := filepath.Join(m.StateDir, legacyStateFileName)
+	if _, err := os.Stat(legacyPath); err != nil {
+		return nil
+	}
+	state, err := m.loadLegacy(legacyPath)
 	if err != nil {
-		return
+		return err
 	}
-	defer file.Close()
-
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
-
-	fmt.Fprintf(writer, "%d", m.state.CurrentIndex)
+	m.state = state
+	if err := m.save(); err != nil {
+		return err
+	}
+	return os.Rename(legacyPath, legacyPath+".bak")
+}
 
+// save writes the state to a temporary file and renames it into place, so a
+// crash never leaves a truncated history.
+func (m *StateManager) save() error {
+	f := stateFile{Version: stateVersion, CurrentIndex: m.state.CurrentIndex, Entries: []stateEntry{}}
 	for _, e := range m.state.History {
-		fmt.Fprint(writer, entrySeparator)
-		for i, op := range e.Operations {
-			fmt.Fprintf(writer, "%d\n%s\n%s\n%s\n%s\n%s",
-				op.Timestamp,
-				m.toStoreValue(op.Action),
-				m.relativePath(op.Path),
-				m.toStoreValue(op.OldContentHash),
-				m.toStoreValue(op.ContentHash),
-				m.relativePath(op.NewPath),
-			)
-			if i < len(e.Operations)-1 {
-				fmt.Fprint(writer, opSeparator)
-			}
+		entry := stateEntry{SessionID: e.SessionID, MessageIndex: e.MessageIndex, Operations: []stateOperation{}}
+		for _, op := range e.Operations {
+			entry.Operations = append(entry.Operations, stateOperation{
+				Timestamp:      op.Timestamp,
+				Action:         op.Action,
+				Path:           m.relativePath(op.Path),
+				OldContentHash: op.OldContentHash,
+				ContentHash:    op.ContentHash,
+				NewPath:        m.relativePath(op.NewPath),
+			})
 		}
+		entry.Checksum = entry.checksum()
+		f.Entries = append(f.Entries, entry)
 	}
-}
 
-func (m *StateManager) fromStoreValue(s string) string {
-	if s == none {
-		return ""
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
 	}
-	return s
-}
 
-func (m *StateManager) toStoreValue(s string) string {
-	if s == "" {
-		return none
+	tmp, err := os.CreateTemp(m.StateDir, stateFileName+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
 	}
-	return s
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), m.statePath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
 }
 
 func (m *StateManager) relativePath(p string) string {
 	if p == "" {
-		return none
+		return ""
 	}
 	if rel, err := filepath.Rel(m.ProjectRoot, p); err == nil {
-		return rel
+		return filepath.ToSlash(rel)
 	}
 	return p
 }
 
 func (m *StateManager) resolvePath(p string) string {
-	if p == "" || p == none {
+	if p == "" {
 		return ""
 	}
+	p = filepath.FromSlash(p)
 	if filepath.IsAbs(p) {
 		return p
 	}
 	return filepath.Join(m.ProjectRoot, p)
 }
 
-func (m *StateManager) Sync() {
+func (m *StateManager) Sync() error {
 	if m.state.CurrentIndex < 0 {
-		return
+		return nil
 	}
 
 	for i := m.state.CurrentIndex; i >= 0; i-- {
@@ -203,15 +325,15 @@ func (m *StateManager) Sync() {
 			if i < m.state.CurrentIndex {
 				m.state.History = m.state.History[:i+1]
 				m.state.CurrentIndex = i
-				m.save()
+				return m.save()
 			}
-			return
+			return nil
 		}
 	}
 
 	m.state.History = []HistoryEntry{}
 	m.state.CurrentIndex = -1
-	m.save()
+	return m.save()
 }
 
 func (m *StateManager) matchState(idx int) bool {
@@ -241,33 +363,101 @@ func (m *StateManager) matchState(idx int) bool {
 	return true
 }
 
-func (m *StateManager) Write(ops []Operation) {
+func (m *StateManager) Write(entry HistoryEntry) error {
 	if m.state.CurrentIndex < len(m.state.History)-1 {
 		m.state.History = m.state.History[:m.state.CurrentIndex+1]
 	}
-	m.state.History = append(m.state.History, HistoryEntry{Operations: ops})
+	m.state.History = append(m.state.History, entry)
 	m.state.CurrentIndex++
-	m.save()
+	return m.save()
 }
 
-func (m *StateManager) GetOperationsToUndo() []Operation {
+func (m *StateManager) GetOperationsToUndo() ([]Operation, error) {
 	if m.state.CurrentIndex < 0 {
-		return nil
+		return nil, nil
 	}
 	ops := m.state.History[m.state.CurrentIndex].Operations
 	m.state.CurrentIndex--
-	m.save()
-	return ops
+	if err := m.save(); err != nil {
+		m.state.CurrentIndex++
+		return nil, err
+	}
+	return ops, nil
 }
 
-func (m *StateManager) GetOperationsToRedo() []Operation {
-	if m.state.CurrentIndex+1 >= len(m.state.History) {
+// FindEntry returns the index of the latest applied entry made by the session
+// for the given message, or for any of its messages when message is negative.
+// It returns -1 when there is none.
+func (m *StateManager) FindEntry(session string, message int) int {
+	for i := m.state.CurrentIndex; i >= 0; i-- {
+		e := m.state.History[i]
+		if e.SessionID == session && (message < 0 || e.MessageIndex == message) {
+			return i
+		}
+	}
+	return -1
+}
+
+// LaterPaths returns the paths of the entry at idx that later applied entries
+// touched again.
+func (m *StateManager) LaterPaths(idx int) []string {
+	later := make(map[string]struct{})
+	for i := idx + 1; i <= m.state.CurrentIndex; i++ {
+		for _, op := range m.state.History[i].Operations {
+			later[op.Path] = struct{}{}
+			if op.NewPath != "" {
+				later[op.NewPath] = struct{}{}
+			}
+		}
+	}
+
+	var paths []string
+	for _, op := range m.state.History[idx].Operations {
+		path := op.Path
+		if op.Action == "rename" {
+			path = op.NewPath
+		}
+		if _, ok := later[path]; ok {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// GetOperationsToUndoAt returns the operations of the entry at idx without
+// changing the history; RemoveUndone takes the entry out once they are undone.
+func (m *StateManager) GetOperationsToUndoAt(idx int) []Operation {
+	if idx < 0 || idx > m.state.CurrentIndex {
 		return nil
 	}
+	return m.state.History[idx].Operations
+}
+
+// RemoveUndone takes the undone entry at idx out of the applied history. The
+// latest entry stays available for redo; an earlier one is dropped since it
+// can no longer be replayed in order.
+func (m *StateManager) RemoveUndone(idx int) error {
+	if idx < 0 || idx > m.state.CurrentIndex {
+		return nil
+	}
+	if idx < m.state.CurrentIndex {
+		m.state.History = append(m.state.History[:idx], m.state.History[idx+1:]...)
+	}
+	m.state.CurrentIndex--
+	return m.save()
+}
+
+func (m *StateManager) GetOperationsToRedo() ([]Operation, error) {
+	if m.state.CurrentIndex+1 >= len(m.state.History) {
+		return nil, nil
+	}
 	m.state.CurrentIndex++
 	ops := m.state.History[m.state.CurrentIndex].Operations
-	m.save()
-	return ops
+	if err := m.save(); err != nil {
+		m.state.CurrentIndex--
+		return nil, err
+	}
+	return ops, nil
 }
 
 func (m *StateManager) CreateOperations(updated []string, actions map[string]string, renames []FileRename, oldHashes map[string]string) []Operation {
@@ -292,7 +482,7 @@ func (m *StateManager) CreateOperations(updated []string, actions map[string]str
 		}
 
 		currentHash, _ := GetFileSHA256(checkPath)
-		if action != "delete" && currentHash != "" {
+		if action != "delete" && currentHash != "" && canBackup(checkPath) {
 			content, _ := os.ReadFile(checkPath)
 			_ = WriteBlob(m.StateDir, currentHash, content)
 		}
@@ -309,3 +499,45 @@ func (m *StateManager) CreateOperations(updated []string, actions map[string]str
 	sort.Slice(ops, func(i, j int) bool { return ops[i].Path < ops[j].Path })
 	return ops
 }
+
+// Check validates the state file and the blobs and trash its entries need
+// for undo and redo, migrating a legacy history first. It returns one line
+// per problem found and leaves the valid entries loaded.
+func (m *StateManager) Check() ([]string, error) {
+	// Lock loads the history, migrating a legacy one, and collects what is
+	// wrong with the state file.
+	unlock, err := m.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	problems := m.TakeProblems()
+	state := m.state
+
+	blobExists := func(hash string) bool {
+		_, err := os.Stat(filepath.Join(m.StateDir, BlobsDir, hash))
+		return err == nil
+	}
+	for i, e := range state.History {
+		for _, op := range e.Operations {
+			rel := m.relativePath(op.Path)
+			if op.OldContentHash != "" && !blobExists(op.OldContentHash) {
+				problems = append(problems, fmt.Sprintf("entry %d: %s: missing blob %s for undo", i+1, rel, op.OldContentHash))
+			}
+			if op.Action != "delete" && op.ContentHash != "" && !blobExists(op.ContentHash) {
+				problems = append(problems, fmt.Sprintf("entry %d: %s: missing blob %s for redo", i+1, rel, op.ContentHash))
+			}
+			if op.Action == "delete" && i <= state.CurrentIndex {
+				if _, err := os.Stat(filepath.Join(m.StateDir, TrashDir, filepath.FromSlash(rel))); err != nil {
+					problems = append(problems, fmt.Sprintf("entry %d: %s: deleted file missing from trash", i+1, rel))
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// EntryCount returns the number of history entries.
+func (m *StateManager) EntryCount() int {
+	return len(m.state.History)
+}
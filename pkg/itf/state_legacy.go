@@ -0,0 +1,84 @@
+package itf
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The legacy states.itf format: the current index on the first line, then
+// entries introduced by "===" lines holding operations of six lines each,
+// separated by "---", with "-" for empty values. It is only read to migrate
+// old histories.
+const (
+	legacyStateFileName = "states.itf"
+	legacyNone          = "-"
+)
+
+func (m *StateManager) loadLegacy(path string) (*State, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	state := &State{CurrentIndex: -1, History: []HistoryEntry{}}
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return state, scanner.Err()
+	}
+	state.CurrentIndex, _ = strconv.Atoi(strings.TrimSpace(scanner.Text()))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "===") {
+			state.History = append(state.History, parseEntryHeader(line))
+			continue
+		}
+
+		if line == "" || line == "---" || len(state.History) == 0 {
+			continue
+		}
+
+		entry := &state.History[len(state.History)-1]
+		op := Operation{Timestamp: parseTimestamp(line)}
+
+		fields := []*string{&op.Action, &op.Path, &op.OldContentHash, &op.ContentHash, &op.NewPath}
+		for _, f := range fields {
+			if !scanner.Scan() {
+				break
+			}
+			*f = fromLegacyValue(strings.TrimSpace(scanner.Text()))
+		}
+
+		op.Path = m.resolvePath(op.Path)
+		op.NewPath = m.resolvePath(op.NewPath)
+		entry.Operations = append(entry.Operations, op)
+	}
+	return state, scanner.Err()
+}
+
+// parseEntryHeader reads "=== <session> <message>"; a bare "===" is an
+// untagged entry.
+func parseEntryHeader(line string) HistoryEntry {
+	e := HistoryEntry{MessageIndex: -1}
+	fields := strings.Fields(strings.TrimPrefix(line, "==="))
+	if len(fields) == 2 {
+		e.SessionID = fields[0]
+		e.MessageIndex, _ = strconv.Atoi(fields[1])
+	}
+	return e
+}
+
+func parseTimestamp(s string) int64 {
+	ts, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return ts
+}
+
+func fromLegacyValue(s string) string {
+	if s == legacyNone {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,192 @@
+package itf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionUndoKeepsEntryOnFailure(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.txt", []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{SessionID: "s1", MessageIndex: 2}
+	if _, err := ApplySummary("```diff\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-one\n+two\n```\n", cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change made after the apply makes the undo fail.
+	if err := os.WriteFile("a.txt", []byte("three\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	undo := func() (Summary, error) {
+		app, err := NewApp(&Config{Undo: true, SessionID: "s1", MessageIndex: 2})
+		if err != nil {
+			return Summary{}, err
+		}
+		return app.Execute()
+	}
+	s, err := undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Failed) != 1 {
+		t.Fatalf("failed = %v, want one failure", s.Failed)
+	}
+
+	// Once the file is back to the applied content, the entry can be undone.
+	if err := os.WriteFile("a.txt", []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = undo(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Failed) > 0 || len(s.Modified) != 1 {
+		t.Fatalf("retry: failed %v, modified %v", s.Failed, s.Modified)
+	}
+	if got, _ := os.ReadFile("a.txt"); string(got) != "one\n" {
+		t.Errorf("a.txt = %q, want the original content", got)
+	}
+}
+
+func TestLegacyMigration(t *testing.T) {
+	t.Chdir(t.TempDir())
+	legacy := "1\n=== s1 3\n100\nmodify\na.txt\nold\nnew\n-\n---\n===\n200\nrename\nb.txt\n-\n-\nc.txt\n---\n"
+	if err := os.MkdirAll(stateDirName, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDirName, legacyStateFileName), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewStateManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(stateDirName, legacyStateFileName+".bak")); err != nil {
+		t.Errorf("legacy file not kept as backup: %v", err)
+	}
+
+	// Reload from the migrated file rather than the in-memory state.
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if problems := m.TakeProblems(); len(problems) > 0 {
+		t.Errorf("problems after migration: %v", problems)
+	}
+	h := m.state.History
+	if m.state.CurrentIndex != 1 || len(h) != 2 {
+		t.Fatalf("current %d, %d entries; want 1, 2", m.state.CurrentIndex, len(h))
+	}
+	if h[0].SessionID != "s1" || h[0].MessageIndex != 3 || h[1].MessageIndex != -1 {
+		t.Errorf("entry tags = %+v, %+v", h[0], h[1])
+	}
+	op := h[0].Operations[0]
+	if op.Action != "modify" || op.Path != filepath.Join(m.ProjectRoot, "a.txt") || op.OldContentHash != "old" || op.ContentHash != "new" || op.NewPath != "" {
+		t.Errorf("first operation = %+v", op)
+	}
+	if op := h[1].Operations[0]; op.Action != "rename" || op.NewPath != filepath.Join(m.ProjectRoot, "c.txt") {
+		t.Errorf("second operation = %+v", op)
+	}
+}
+
+func TestChecksumMismatchDropsLaterEntries(t *testing.T) {
+	t.Chdir(t.TempDir())
+	m, err := NewStateManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		op := Operation{Action: "create", Path: filepath.Join(m.ProjectRoot, "f.txt"), ContentHash: "h"}
+		if err := m.Write(HistoryEntry{MessageIndex: i, Operations: []Operation{op}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tamper with the second entry without fixing its checksum.
+	data, err := os.ReadFile(m.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Entries[1].Operations[0].Path = "other.txt"
+	tampered, _ := json.Marshal(f)
+	if err := os.WriteFile(m.statePath, tampered, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := m.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.state.History) != 1 || m.state.CurrentIndex != 0 {
+		t.Errorf("kept %d entries, current %d; want 1, 0", len(m.state.History), m.state.CurrentIndex)
+	}
+	report := strings.Join(problems, "\n")
+	for _, want := range []string{"entry 2: checksum mismatch", "dropped entries 2-3 of 3", ".bak"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("problems %q do not mention %q", report, want)
+		}
+	}
+
+	backups, _ := filepath.Glob(m.statePath + ".*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want one", backups)
+	}
+	if got, _ := os.ReadFile(backups[0]); string(got) != string(tampered) {
+		t.Error("backup differs from the original state file")
+	}
+
+	// Loading the same file again reuses the backup.
+	if err := m.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := filepath.Glob(m.statePath + ".*.bak"); len(backups) != 1 {
+		t.Errorf("backups after reload = %v, want one", backups)
+	}
+}
+
+func TestSaveIsAtomic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	m, err := NewStateManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string) error {
+		return m.Write(HistoryEntry{Operations: []Operation{{Action: "create", Path: filepath.Join(m.ProjectRoot, name)}}})
+	}
+	tempFiles := func() []string {
+		matches, _ := filepath.Glob(filepath.Join(m.StateDir, stateFileName+".tmp-*"))
+		return matches
+	}
+
+	if err := write("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if leftovers := tempFiles(); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+	if err := m.reload(); err != nil || len(m.state.History) != 1 {
+		t.Fatalf("reload: %d entries, err %v", len(m.state.History), err)
+	}
+
+	// A save whose rename fails reports it and cleans up its temporary file.
+	if err := os.Remove(m.statePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(m.statePath, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := write("b.txt"); err == nil {
+		t.Fatal("Write succeeded although the state file could not be replaced")
+	}
+	if leftovers := tempFiles(); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind after a failed save: %v", leftovers)
+	}
+}
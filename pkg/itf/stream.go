@@ -0,0 +1,175 @@
+package itf
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// StreamApplier applies code blocks while a response is still streaming. Each
+// block is written as soon as its closing fence arrives; Close records every
+// change made during the stream as a single history entry. Blocks that arrive
+// while another itf operation holds the lock wait for a later chunk, so Write
+// never blocks.
+type StreamApplier struct {
+	app     *App
+	parser  *StreamParser
+	policy  *WritePolicy
+	plan    *ExecutionPlan
+	state   *applyState
+	pending []CodeBlock
+	// written holds the paths changed by earlier blocks, which no longer
+	// match the baseline because of the stream itself.
+	written map[string]bool
+	// synced is set once the history was checked against the files, which
+	// must happen before the first write of the stream.
+	synced bool
+	// lockErr is the last lock failure reported by Write, so that a busy
+	// lock is reported once rather than for every chunk.
+	lockErr string
+}
+
+func NewStreamApplier(config Config) (*StreamApplier, error) {
+	app, err := NewApp(&config)
+	if err != nil {
+		return nil, err
+	}
+	policy := NewWritePolicy(app.stateManager.ProjectRoot, config.Protected, config.Allow, app.pathResolver)
+	policy.AllowLarge = config.AllowLarge
+	policy.Placeholder = config.Placeholder
+	return &StreamApplier{
+		app:     app,
+		parser:  NewStreamParser(),
+		policy:  policy,
+		plan:    &ExecutionPlan{FileActions: make(map[string]string)},
+		state:   newApplyState(),
+		written: make(map[string]bool),
+	}, nil
+}
+
+// Write feeds a streamed chunk and returns the results of the blocks it
+// completed.
+func (s *StreamApplier) Write(chunk string) []FileResult {
+	s.pending = append(s.pending, s.parser.Write(chunk)...)
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	unlock, err := s.app.stateManager.TryLock()
+	if err != nil {
+		if err.Error() == s.lockErr {
+			return nil
+		}
+		s.lockErr = err.Error()
+		r := FileResult{
+			Path:      filepath.Join(s.app.stateManager.StateDir, lockFileName),
+			Action:    "lock",
+			Status:    StatusFailed,
+			ErrorKind: ErrKindLocked,
+			Error:     fmt.Sprintf("%d block(s) waiting: %v", len(s.pending), err),
+		}
+		if !errors.Is(err, ErrLocked) {
+			r.ErrorKind = ErrKindIO
+		}
+		return s.app.relativizeResults([]FileResult{r})
+	}
+	defer unlock()
+	s.lockErr = ""
+	return s.applyPending()
+}
+
+// Close applies the blocks completed by a trailing partial line, runs
+// formatters and records the history entry. A block still open when the
+// stream ends is not applied and is reported as incomplete.
+func (s *StreamApplier) Close() (sum Summary, err error) {
+	unlock, err := s.app.stateManager.Lock()
+	if err != nil {
+		return Summary{}, err
+	}
+	defer unlock()
+	defer s.app.reportStateProblems(&sum)
+
+	blocks, incomplete := s.parser.Flush()
+	s.pending = append(s.pending, blocks...)
+	s.applyPending()
+	if incomplete != nil {
+		s.plan.fail(s.incompleteResult(*incomplete))
+	}
+
+	if len(s.state.results) == 0 {
+		if len(s.plan.Failed) > 0 || len(s.plan.Stale) > 0 {
+			sum = Summary{Failed: s.plan.Failed, Stale: s.plan.Stale, Warnings: s.plan.Warnings, Results: s.app.relativizeResults(s.plan.Results)}
+			s.app.relativizeSummaryPaths(&sum)
+			return sum, nil
+		}
+		return Summary{Message: "Nothing to do"}, nil
+	}
+	return s.app.finishApply(s.plan, s.state)
+}
+
+func (s *StreamApplier) applyPending() []FileResult {
+	blocks := s.pending
+	s.pending = nil
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	a := s.app
+	if !s.synced {
+		if err := a.stateManager.Sync(); err != nil {
+			s.plan.Warnings = append(s.plan.Warnings, fmt.Sprintf("failed to save history: %v", err))
+		}
+		s.synced = true
+	}
+	for i := range blocks {
+		blocks[i].Content = a.restore(blocks[i].Content)
+	}
+	plan := createPlanFromBlocks(blocks, a.pathResolver, a.cfg.Extensions, a.cfg.Files, s.policy)
+	if !a.cfg.Force {
+		a.dropStaleActions(plan, s.written)
+	}
+	CreateDirs(plan.DirsToCreate)
+
+	before := len(s.state.results)
+	a.executePlan(plan, s.state)
+	for _, r := range s.state.results[before:] {
+		if r.Status != StatusApplied {
+			continue
+		}
+		s.written[r.Path] = true
+		if r.NewPath != "" {
+			s.written[r.NewPath] = true
+		}
+	}
+
+	// The first action seen for a path decides how history records it, so a
+	// file created and then patched during the stream is undone by deletion.
+	for path, action := range plan.FileActions {
+		if _, ok := s.plan.FileActions[path]; !ok {
+			s.plan.FileActions[path] = action
+		}
+	}
+	s.plan.Failed = append(s.plan.Failed, plan.Failed...)
+	s.plan.Stale = append(s.plan.Stale, plan.Stale...)
+	s.plan.Warnings = append(s.plan.Warnings, plan.Warnings...)
+	s.plan.Results = append(s.plan.Results, plan.Results...)
+
+	results := append(append([]FileResult{}, plan.Results...), s.state.results[before:]...)
+	return a.relativizeResults(results)
+}
+
+// incompleteResult reports a block cut off by the end of the stream.
+func (s *StreamApplier) incompleteResult(b CodeBlock) FileResult {
+	path := ExtractPathFromHint(b.Hint)
+	if b.Lang == "diff" {
+		path = ExtractPathFromDiff(b.Content)
+	}
+	if path == "" {
+		path = "code block"
+	} else {
+		path = s.app.pathResolver.Resolve(path)
+	}
+	r := failedResult(path, "write", errors.New("the response ended before the closing fence; block not applied"))
+	r.ErrorKind = ErrKindIncomplete
+	return r
+}
@@ -0,0 +1,91 @@
+package itf
+
+import (
+	"os"
+	"testing"
+)
+
+func TestStreamApplierPatchesFileTwice(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.txt", []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := GetFileSHA256("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStreamApplier(Config{Baseline: map[string]string{"a.txt": hash}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write("```diff\n--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n-one\n+ONE\n two\n three\n```\n")
+	s.Write("```diff\n--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n ONE\n two\n-three\n+THREE\n```\n")
+	sum, err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sum.Stale) > 0 || len(sum.Failed) > 0 {
+		t.Fatalf("stale %v, failed %v", sum.Stale, sum.Failed)
+	}
+	got, _ := os.ReadFile("a.txt")
+	if string(got) != "ONE\ntwo\nTHREE\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+}
+
+func TestStreamApplierWaitsForLock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s, err := NewStreamApplier(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := s.app.stateManager.TryLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := s.Write("`a.go`\n\n```go\npackage a\n```\n")
+	if len(results) != 1 || results[0].ErrorKind != ErrKindLocked {
+		t.Fatalf("results while locked = %+v, want one lock failure", results)
+	}
+	if results := s.Write("more text\n"); len(results) != 0 {
+		t.Errorf("lock failure reported again: %+v", results)
+	}
+
+	unlock()
+	results = s.Write("done\n")
+	if len(results) != 1 || results[0].Status != StatusApplied {
+		t.Fatalf("results after unlock = %+v, want a.go applied", results)
+	}
+	if _, err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamApplierDropsUnclosedBlock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.txt", []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStreamApplier(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stream is cancelled half way through a whole-file block.
+	s.Write("`a.txt`\n\n```\none\n")
+	sum, err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile("a.txt")
+	if string(got) != "one\ntwo\nthree\n" {
+		t.Errorf("a.txt = %q, want it unchanged", got)
+	}
+	if len(sum.Results) != 1 || sum.Results[0].ErrorKind != ErrKindIncomplete || sum.Results[0].Path != "a.txt" {
+		t.Errorf("results = %+v, want a.txt reported incomplete", sum.Results)
+	}
+}
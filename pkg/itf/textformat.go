@@ -0,0 +1,107 @@
+package itf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+const defaultFileMode os.FileMode = 0644
+
+// textFormat captures the on-disk conventions of a file so that rewriting it
+// does not silently change anything besides its lines.
+type textFormat struct {
+	mode            os.FileMode
+	crlf            bool
+	bom             bool
+	trailingNewline bool
+}
+
+func detectTextFormat(path string) textFormat {
+	f := textFormat{mode: defaultFileMode, trailingNewline: true}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return f
+	}
+	f.mode = info.Mode().Perm()
+
+	content, err := os.ReadFile(path)
+	if err != nil || len(content) == 0 {
+		return f
+	}
+	f.bom = bytes.HasPrefix(content, utf8BOM)
+	f.crlf = bytes.Contains(content, []byte("\r\n"))
+	f.trailingNewline = bytes.HasSuffix(content, []byte("\n"))
+	return f
+}
+
+func (f textFormat) encode(lines []string) []byte {
+	eol := "\n"
+	if f.crlf {
+		eol = "\r\n"
+	}
+
+	var b bytes.Buffer
+	if f.bom {
+		b.Write(utf8BOM)
+	}
+	for i, line := range lines {
+		b.WriteString(strings.TrimSuffix(line, "\r"))
+		if i < len(lines)-1 || f.trailingNewline {
+			b.WriteString(eol)
+		}
+	}
+	return b.Bytes()
+}
+
+// decodeLines splits file content into lines without BOM, CR or the final
+// newline, which is the form diffs are matched against.
+func decodeLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	text := string(bytes.TrimPrefix(content, utf8BOM))
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// resolveSymlink returns the file a symlink points to so that writes go to the
+// target instead of replacing the link with a regular file.
+func resolveSymlink(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return path
+	}
+
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		return target
+	}
+
+	link, err := os.Readlink(path)
+	if err != nil {
+		return path
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(path), link)
+	}
+	return link
+}
+
+func fileMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return defaultFileMode
+}
+
+func writeFilePreserving(path string, data []byte, mode os.FileMode) error {
+	target := resolveSymlink(path)
+	if err := os.WriteFile(target, data, mode); err != nil {
+		return err
+	}
+	return os.Chmod(target, mode)
+}
@@ -0,0 +1,117 @@
+package itf
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWritesPreserveFileFormat(t *testing.T) {
+	diff := func(path, from, to string) string {
+		return "```diff\n--- a/" + path + "\n+++ b/" + path + "\n@@ -1,2 +1,2 @@\n one\n-" + from + "\n+" + to + "\n```\n"
+	}
+	whole := func(path, content string) string {
+		return "`" + path + "`\n\n```\n" + content + "```\n"
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		mode    os.FileMode
+		input   string
+		want    string
+	}{
+		{
+			name:    "crlf and bom through a diff",
+			path:    "win.txt",
+			content: "\uFEFFone\r\ntwo\r\n",
+			mode:    0644,
+			input:   diff("win.txt", "two", "TWO"),
+			want:    "\uFEFFone\r\nTWO\r\n",
+		},
+		{
+			name:    "crlf and bom through a whole file",
+			path:    "win.txt",
+			content: "\uFEFFone\r\ntwo\r\n",
+			mode:    0644,
+			input:   whole("win.txt", "one\ntwo\nthree\n"),
+			want:    "\uFEFFone\r\ntwo\r\nthree\r\n",
+		},
+		{
+			name:    "missing final newline",
+			path:    "bare.txt",
+			content: "one\ntwo",
+			mode:    0644,
+			input:   diff("bare.txt", "two", "TWO"),
+			want:    "one\nTWO",
+		},
+		{
+			name:    "executable through a diff",
+			path:    "run.sh",
+			content: "one\ntwo\n",
+			mode:    0755,
+			input:   diff("run.sh", "two", "TWO"),
+			want:    "one\nTWO\n",
+		},
+		{
+			name:    "executable through a whole file",
+			path:    "run.sh",
+			content: "one\ntwo\n",
+			mode:    0755,
+			input:   whole("run.sh", "one\nTWO\n"),
+			want:    "one\nTWO\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Chdir(t.TempDir())
+		if err := os.WriteFile(tt.path, []byte(tt.content), tt.mode); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := ApplySummary(tt.input, Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sum.Failed) > 0 {
+			t.Fatalf("%s: failed %v", tt.name, sum.Results)
+		}
+		got, _ := os.ReadFile(tt.path)
+		if string(got) != tt.want {
+			t.Errorf("%s: %s = %q, want %q", tt.name, tt.path, got, tt.want)
+		}
+		if info, err := os.Stat(tt.path); err != nil || info.Mode().Perm() != tt.mode {
+			t.Errorf("%s: mode %v, want %v", tt.name, info.Mode().Perm(), tt.mode)
+		}
+	}
+}
+
+func TestWritesFollowSymlinks(t *testing.T) {
+	for _, input := range []string{
+		"```diff\n--- a/link.txt\n+++ b/link.txt\n@@ -1 +1 @@\n-one\n+two\n```\n",
+		"`link.txt`\n\n```\ntwo\n```\n",
+	} {
+		t.Chdir(t.TempDir())
+		if err := os.Mkdir("real", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile("real/a.txt", []byte("one\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("real/a.txt", "link.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		sum, err := ApplySummary(input, Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sum.Failed) > 0 {
+			t.Fatalf("failed %v", sum.Results)
+		}
+		if info, err := os.Lstat("link.txt"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("link.txt is no longer a symlink")
+		}
+		if got, _ := os.ReadFile("real/a.txt"); string(got) != "two\n" {
+			t.Errorf("real/a.txt = %q, want the write to go through the link", got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 var (
@@ -16,6 +17,7 @@ var (
 	successStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("78"))
 	deletedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("204"))
 	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("197"))
+	staleStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
 )
 
 type spinner struct {
@@ -106,6 +108,58 @@ func FormatSummary(s Summary) string {
 	renderList("Renamed:", renamedStyle, s.Renamed)
 	renderList("Deleted:", deletedStyle, s.Deleted)
 	renderList("Failed:", errorStyle, s.Failed)
+	for _, r := range s.Results {
+		if r.Diagnostic != nil {
+			b.WriteString(formatDiagnostic(r))
+		}
+	}
+	renderList("Warnings:", staleStyle, s.Warnings)
+	renderList("Stale (changed on disk since the prompt was built, not applied):", staleStyle, s.Stale)
+
+	return b.String()
+}
+
+const diagnosticColumnWidth = 60
+
+// formatDiagnostic shows the lines a failed hunk expected next to the closest
+// region of the file.
+func formatDiagnostic(r FileResult) string {
+	d := r.Diagnostic
+	var b strings.Builder
+	if d.Line == 0 {
+		b.WriteString(errorStyle.Render(fmt.Sprintf("%s hunk #%d: no similar region found", r.Path, r.Hunk)) + "\n")
+		return b.String()
+	}
+	b.WriteString(errorStyle.Render(fmt.Sprintf("%s hunk #%d: closest match at lines %d-%d (%.0f%% similar)", r.Path, r.Hunk, d.Line, d.EndLine, d.Score*100)) + "\n")
 
+	clean := func(s string) string {
+		s = strings.ReplaceAll(s, "\t", "    ")
+		return ansi.Truncate(s, diagnosticColumnWidth, "...")
+	}
+	// pad fills by display width, which %-*s would count in bytes.
+	pad := func(s string, width int) string {
+		return s + strings.Repeat(" ", max(0, width-ansi.StringWidth(s)))
+	}
+
+	width := len("expected")
+	for _, l := range d.Expected {
+		width = max(width, ansi.StringWidth(clean(l)))
+	}
+
+	fmt.Fprintf(&b, "  %s | %s\n", pad("expected", width), "actual")
+	for i := 0; i < max(len(d.Expected), len(d.Actual)); i++ {
+		var exp, act string
+		if i < len(d.Expected) {
+			exp = d.Expected[i]
+		}
+		if i < len(d.Actual) {
+			act = d.Actual[i]
+		}
+		sep := "|"
+		if !linesMatch(exp, act) {
+			sep = "!"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", pad(clean(exp), width), sep, clean(act))
+	}
 	return b.String()
 }
@@ -0,0 +1,143 @@
+package pcat
+
+import (
+	"crypto/sha256"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Cache keeps read files and token counts between runs, so that a run only
+// reads the files whose size or modification time changed and only counts
+// the tokens of blocks it has not rendered before. Entries not used by a run
+// are dropped at its end. A Cache must not be shared by concurrent runs.
+type Cache struct {
+	mu         sync.Mutex
+	blocks     map[cacheKey]cacheEntry
+	tokens     map[[sha256.Size]byte]int
+	nextBlocks map[cacheKey]cacheEntry
+	nextTokens map[[sha256.Size]byte]int
+	total      int
+}
+
+type cacheKey struct {
+	file            string
+	withLineNumbers bool
+	outline         bool
+}
+
+type cacheEntry struct {
+	size    int64
+	modTime time.Time
+	block   fileBlock
+	ok      bool
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		blocks: make(map[cacheKey]cacheEntry),
+		tokens: make(map[[sha256.Size]byte]int),
+	}
+}
+
+// Tokens returns the token count of the files in the last run's output.
+func (c *Cache) Tokens() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+func (c *Cache) begin() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextBlocks = make(map[cacheKey]cacheEntry, len(c.blocks))
+	c.nextTokens = make(map[[sha256.Size]byte]int, len(c.tokens))
+}
+
+func (c *Cache) end(total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocks, c.nextBlocks = c.nextBlocks, nil
+	c.tokens, c.nextTokens = c.nextTokens, nil
+	c.total = total
+}
+
+func (c *Cache) read(file string, withLineNumbers, outline bool) (fileBlock, bool) {
+	info, err := os.Stat(ParseSelector(file).Path)
+	if err != nil {
+		return fileBlock{}, false
+	}
+
+	key := cacheKey{file: file, withLineNumbers: withLineNumbers, outline: outline}
+	c.mu.Lock()
+	e, hit := c.blocks[key]
+	c.mu.Unlock()
+	if !hit || e.size != info.Size() || !e.modTime.Equal(info.ModTime()) {
+		e = cacheEntry{size: info.Size(), modTime: info.ModTime()}
+		e.block, e.ok = readBlock(file, withLineNumbers, outline)
+	}
+
+	c.mu.Lock()
+	c.nextBlocks[key] = e
+	c.mu.Unlock()
+	return e.block, e.ok
+}
+
+// count returns the token count of the block as rendered in format, counting
+// with countTokens on a miss.
+func (c *Cache) count(b fileBlock, format string, countTokens func(string) int) int {
+	text := b.render(format)
+	sum := sha256.Sum256([]byte(text))
+
+	c.mu.Lock()
+	n, hit := c.tokens[sum]
+	c.mu.Unlock()
+	if !hit {
+		n = countTokens(text)
+	}
+
+	c.mu.Lock()
+	c.nextTokens[sum] = n
+	c.mu.Unlock()
+	return n
+}
+
+// readBlocks reads files in parallel, through cache when it is not nil, and
+// returns the readable ones in order.
+func readBlocks(files []string, withLineNumbers, outline bool, cache *Cache) []fileBlock {
+	type result struct {
+		block fileBlock
+		ok    bool
+	}
+	results := make([]result, len(files))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if cache != nil {
+					results[i].block, results[i].ok = cache.read(files[i], withLineNumbers, outline)
+				} else {
+					results[i].block, results[i].ok = readBlock(files[i], withLineNumbers, outline)
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var blocks []fileBlock
+	for _, r := range results {
+		if r.ok {
+			blocks = append(blocks, r.block)
+		}
+	}
+	return blocks
+}
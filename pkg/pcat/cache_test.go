@@ -0,0 +1,61 @@
+package pcat
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheRereadsOnlyChangedFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	write := func(name, content string, modTime time.Time) {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	then := time.Now().Add(-time.Hour)
+	write("a.txt", "alpha\n", then)
+	write("b.txt", "bravo\n", then)
+
+	cache := NewCache()
+	counted := 0
+	run := func() string {
+		out, err := RunWithOptions(Options{
+			ListedFiles: []string{"a.txt", "b.txt"},
+			Cache:       cache,
+			CountTokens: func(s string) int { counted++; return len(s) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	run()
+	if counted != 2 {
+		t.Fatalf("first run counted %d blocks, want 2", counted)
+	}
+
+	// b.txt keeps its size and modification time, so the cached content is
+	// used even though the file changed; a.txt grows and is read again.
+	write("a.txt", "alpha two\n", time.Now())
+	write("b.txt", "BRAVO\n", then)
+	counted = 0
+	out := run()
+	if !strings.Contains(out, "alpha two\n") {
+		t.Errorf("a.txt was not read again:\n%s", out)
+	}
+	if !strings.Contains(out, "bravo\n") || strings.Contains(out, "BRAVO") {
+		t.Errorf("b.txt was read again:\n%s", out)
+	}
+	if counted != 1 {
+		t.Errorf("second run counted %d blocks, want 1", counted)
+	}
+	if want := len(out) - len(frame(FormatMarkdown)); cache.Tokens() != want {
+		t.Errorf("Tokens() = %d, want %d", cache.Tokens(), want)
+	}
+}
@@ -0,0 +1,56 @@
+package pcat
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// ReadFileList reads paths, one per line or, with nul, separated by NUL
+// bytes as printed by `sf -0` or `find -print0`. Lines are trimmed of
+// surrounding whitespace; NUL-separated paths are taken as they are, so any
+// name is safe. Empty entries are skipped.
+func ReadFileList(r io.Reader, nul bool) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	if nul {
+		scanner.Split(scanNul)
+	}
+
+	var paths []string
+	for scanner.Scan() {
+		path := scanner.Text()
+		if !nul {
+			path = strings.TrimSpace(path)
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// JoinFileList is the inverse of ReadFileList: it prints each path followed
+// by a newline or, with nul, a NUL byte.
+func JoinFileList(paths []string, nul bool) string {
+	sep := "\n"
+	if nul {
+		sep = "\x00"
+	}
+	var out strings.Builder
+	for _, p := range paths {
+		out.WriteString(p + sep)
+	}
+	return out.String()
+}
@@ -0,0 +1,42 @@
+package pcat
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadFileList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		nul   bool
+		want  []string
+	}{
+		{"lines", "a.go\nsub/b.go\n", false, []string{"a.go", "sub/b.go"}},
+		{"no trailing newline", "a.go\nb.go", false, []string{"a.go", "b.go"}},
+		{"trimmed lines", "  a.go \r\n\tb.go\n", false, []string{"a.go", "b.go"}},
+		{"empty lines", "\na.go\n\n\nb.go\n\n", false, []string{"a.go", "b.go"}},
+		{"nothing", "", false, nil},
+		{"nul", "a.go\x00sub/b.go\x00", true, []string{"a.go", "sub/b.go"}},
+		{"nul without a final separator", "a.go\x00b.go", true, []string{"a.go", "b.go"}},
+		{"nul keeps odd names", " a b.go \x00new\nline.go\x00", true, []string{" a b.go ", "new\nline.go"}},
+		{"empty nul entries", "\x00a.go\x00\x00", true, []string{"a.go"}},
+		{"newlines without nul", "a.go\nb.go\n", true, []string{"a.go\nb.go\n"}},
+	}
+	for _, tt := range tests {
+		got, err := ReadFileList(strings.NewReader(tt.input), tt.nul)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: ReadFileList(%q, %v) = %q, want %q", tt.name, tt.input, tt.nul, got, tt.want)
+		}
+		if tt.want != nil {
+			back, _ := ReadFileList(strings.NewReader(JoinFileList(got, tt.nul)), tt.nul)
+			if !slices.Equal(back, got) {
+				t.Errorf("%s: JoinFileList does not round-trip: %q", tt.name, back)
+			}
+		}
+	}
+}
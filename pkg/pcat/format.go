@@ -0,0 +1,272 @@
+package pcat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sokinpui/coder/pkg/sf"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatXML      = "xml"
+	FormatJSON     = "json"
+)
+
+var Formats = []string{FormatMarkdown, FormatXML, FormatJSON}
+
+// fileBlock is one file of the output before it is rendered. Start and End
+// are set for a partial file; an Omitted block stands for a file left out
+// to fit the token budget. A Diff block holds Options.Diff instead of a file.
+type fileBlock struct {
+	file    string
+	Path    string
+	Lang    string
+	Start   int
+	End     int
+	Total   int
+	Outline bool
+	Content string
+	Omitted bool
+	Size    int64
+	Tokens  int
+	Diff    bool
+	modTime time.Time
+}
+
+// jsonFile is the JSON form of a fileBlock.
+type jsonFile struct {
+	Path       string `json:"path,omitempty"`
+	Lang       string `json:"lang,omitempty"`
+	Lines      string `json:"lines,omitempty"`
+	TotalLines int    `json:"total_lines,omitempty"`
+	Outline    bool   `json:"outline,omitempty"`
+	Content    string `json:"content,omitempty"`
+	Omitted    bool   `json:"omitted,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Tokens     int    `json:"tokens,omitempty"`
+	Diff       bool   `json:"diff,omitempty"`
+}
+
+// readBlock reads a file or selector. Binary and unreadable files are
+// skipped. Outlines are read without line numbers, which would not be
+// contiguous.
+func readBlock(file string, withLineNumbers, outline bool) (fileBlock, bool) {
+	sel := ParseSelector(file)
+	info, err := os.Stat(sel.Path)
+	if err != nil {
+		return fileBlock{}, false
+	}
+	content, err := os.ReadFile(sel.Path)
+	if err != nil || bytes.Contains(content, []byte{0}) {
+		return fileBlock{}, false
+	}
+
+	b := fileBlock{
+		file:    file,
+		Path:    sel.Path,
+		Lang:    getLang(sel.Path),
+		Total:   countLines(content),
+		Size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+	firstLine := 1
+	switch {
+	case sel.Outline || (outline && sel.IsWhole()):
+		b.Outline = true
+		content = Outline(sel.Path, content)
+		withLineNumbers = false
+	case !sel.IsWhole():
+		start, end, err := sel.Lines(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			return fileBlock{}, false
+		}
+		b.Start, b.End = start, end
+		content = sliceLines(content, start, end)
+		firstLine = start
+	}
+
+	var out strings.Builder
+	if withLineNumbers {
+		writeWithLineNumbers(&out, content, firstLine)
+	} else {
+		out.Write(content)
+	}
+	ensureNewline(&out, content)
+	b.Content = out.String()
+	return b, true
+}
+
+func renderBlocks(blocks []fileBlock, format string) (string, error) {
+	if len(blocks) == 0 {
+		return "", nil
+	}
+
+	if format == FormatJSON {
+		// Each element is rendered as MarshalIndent prints it inside the
+		// array, so that token counts match the output.
+		var out strings.Builder
+		out.WriteString("[\n")
+		for _, b := range blocks {
+			out.WriteString(b.render(format))
+		}
+		return strings.TrimSuffix(out.String(), ",\n") + "\n]\n", nil
+	}
+
+	var out strings.Builder
+	for _, b := range blocks {
+		out.WriteString(b.render(format))
+	}
+	result := strings.TrimSuffix(out.String(), "\n")
+	if format == FormatXML {
+		return result, nil
+	}
+	return result + "\n---\n", nil
+}
+
+// frame returns the text renderBlocks adds around the rendered blocks.
+func frame(format string) string {
+	switch format {
+	case FormatXML:
+		return ""
+	case FormatJSON:
+		return "[\n]\n"
+	default:
+		return "---\n"
+	}
+}
+
+// render returns the block as it appears in the output, followed by a blank
+// line, or for JSON as an indented array element followed by a comma.
+func (b fileBlock) render(format string) string {
+	switch format {
+	case FormatXML:
+		return b.xml()
+	case FormatJSON:
+		data, _ := json.MarshalIndent(b.json(), "  ", "  ")
+		return "  " + string(data) + ",\n"
+	default:
+		return b.markdown()
+	}
+}
+
+func (b fileBlock) markdown() string {
+	if b.Diff {
+		fence := getFence(b.Lang, b.Content)
+		return fmt.Sprintf("Diff of the files above:\n%sdiff\n%s%s\n\n", fence, withNewline(b.Content), fence)
+	}
+	if b.Omitted {
+		return fmt.Sprintf("`%s` (omitted to fit the token budget: %s, ~%d tokens)\n\n", b.Path, sf.FormatSize(b.Size), b.Tokens)
+	}
+
+	var out strings.Builder
+	switch {
+	case b.Outline:
+		fmt.Fprintf(&out, "`%s` (outline)\n", b.Path)
+	case b.Start > 0:
+		fmt.Fprintf(&out, "`%s` (%s)\n", b.Path, describeRange(b.Start, b.End, b.Total))
+	default:
+		fmt.Fprintf(&out, "`%s`\n", b.Path)
+	}
+
+	fence := getFence(b.Lang, b.Content)
+	fmt.Fprintf(&out, "%s%s\n%s%s\n\n", fence, b.Lang, b.Content, fence)
+	return out.String()
+}
+
+func (b fileBlock) xml() string {
+	attr := func(name, value string) string {
+		return fmt.Sprintf(` %s="%s"`, name, html.EscapeString(value))
+	}
+
+	if b.Diff {
+		return fmt.Sprintf("<diff>%s</diff>\n\n", cdata("\n"+withNewline(b.Content)))
+	}
+
+	tag := "<file" + attr("path", b.Path)
+	if b.Omitted {
+		tag += attr("omitted", "true") + attr("size", sf.FormatSize(b.Size)) + attr("tokens", fmt.Sprint(b.Tokens))
+		return tag + " />\n\n"
+	}
+
+	tag += attr("lang", b.Lang)
+	if b.Outline {
+		tag += attr("outline", "true")
+	} else {
+		tag += attr("lines", b.lines()) + attr("total", fmt.Sprint(b.Total))
+	}
+	return fmt.Sprintf("%s>%s</file>\n\n", tag, cdata("\n"+withNewline(b.Content)))
+}
+
+// cdata wraps s in a CDATA section, so that file content such as "</file>"
+// cannot end the element. A "]]>" in s is split across two sections.
+func cdata(s string) string {
+	return "<![CDATA[" + strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+func (b fileBlock) json() jsonFile {
+	if b.Diff {
+		return jsonFile{Lang: b.Lang, Content: b.Content, Diff: true}
+	}
+	f := jsonFile{Path: b.Path, Omitted: b.Omitted}
+	if b.Omitted {
+		f.Size, f.Tokens = b.Size, b.Tokens
+		return f
+	}
+	f.Lang, f.Outline, f.Content = b.Lang, b.Outline, b.Content
+	if !b.Outline {
+		f.Lines, f.TotalLines = b.lines(), b.Total
+	}
+	return f
+}
+
+func (b fileBlock) lines() string {
+	if b.Start > 0 {
+		return fmt.Sprintf("%d-%d", b.Start, b.End)
+	}
+	return fmt.Sprintf("1-%d", b.Total)
+}
+
+// getFence returns a fence longer than any backtick run that starts a line
+// of the content, so files that contain fences do not end the block early.
+func getFence(lang, content string) string {
+	n := 3
+	if lang == "md" || lang == "markdown" {
+		n = 4
+	}
+	for line := range strings.SplitSeq(content, "\n") {
+		line = strings.TrimLeft(line, " \t")
+		run := len(line) - len(strings.TrimLeft(line, "`"))
+		if run >= n {
+			n = run + 1
+		}
+	}
+	return strings.Repeat("`", n)
+}
+
+func withNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		return s + "\n"
+	}
+	return s
+}
+
+func writeWithLineNumbers(out *strings.Builder, content []byte, firstLine int) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for i := firstLine; scanner.Scan(); i++ {
+		out.WriteString(fmt.Sprintf("%4d | %s\n", i, scanner.Text()))
+	}
+}
+
+func ensureNewline(out *strings.Builder, content []byte) {
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		out.WriteString("\n")
+	}
+}
@@ -0,0 +1,105 @@
+package pcat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMLContentRoundTrips(t *testing.T) {
+	contents := []string{
+		"plain\n",
+		"</file>\n<file path=\"evil\">\n",
+		"a]]>b\n",
+		"]]>]]>\n",
+		"<![CDATA[x]]>\n",
+	}
+	var blocks []fileBlock
+	for _, c := range contents {
+		blocks = append(blocks, fileBlock{Path: `a "&" b.go`, Lang: "go", Content: c, Total: 1})
+	}
+	out, err := renderBlocks(blocks, FormatXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Files []struct {
+			Path    string `xml:"path,attr"`
+			Content string `xml:",chardata"`
+		} `xml:"file"`
+	}
+	if err := xml.Unmarshal([]byte("<root>"+out+"</root>"), &doc); err != nil {
+		t.Fatalf("output is not XML: %v\n%s", err, out)
+	}
+	if len(doc.Files) != len(contents) {
+		t.Fatalf("got %d files, want %d:\n%s", len(doc.Files), len(contents), out)
+	}
+	for i, f := range doc.Files {
+		if f.Path != `a "&" b.go` {
+			t.Errorf("path %q", f.Path)
+		}
+		if want := "\n" + contents[i]; f.Content != want {
+			t.Errorf("content %q, want %q", f.Content, want)
+		}
+	}
+}
+
+func TestJSONShape(t *testing.T) {
+	blocks := []fileBlock{
+		{Path: "a.go", Lang: "go", Content: "package a\n", Total: 1},
+		{Path: "b.go", Lang: "go", Content: "func B()\n", Start: 3, End: 4, Total: 9},
+		{Path: "c.go", Lang: "go", Content: "package c\n", Outline: true},
+		{Path: "d.go", Omitted: true, Size: 2048, Tokens: 512},
+		{Diff: true, Lang: "diff", Content: "-a\n+b\n"},
+	}
+	out, err := renderBlocks(blocks, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	want := []map[string]any{
+		{"path": "a.go", "lang": "go", "lines": "1-1", "total_lines": 1.0, "content": "package a\n"},
+		{"path": "b.go", "lang": "go", "lines": "3-4", "total_lines": 9.0, "content": "func B()\n"},
+		{"path": "c.go", "lang": "go", "outline": true, "content": "package c\n"},
+		{"path": "d.go", "omitted": true, "size": 2048.0, "tokens": 512.0},
+		{"lang": "diff", "diff": true, "content": "-a\n+b\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+}
+
+func TestGetFence(t *testing.T) {
+	tests := []struct {
+		lang    string
+		content string
+		want    string
+	}{
+		{"go", "package a\n", "```"},
+		{"md", "# a\n", "````"},
+		{"go", "// ``x`` is inline\n", "```"},
+		{"go", "```\ncode\n```\n", "````"},
+		{"md", "````\ncode\n````\n", "`````"},
+		{"go", "  ``````indented\n", "```````"},
+	}
+	for _, tt := range tests {
+		if got := getFence(tt.lang, tt.content); got != tt.want {
+			t.Errorf("getFence(%q, %q) = %q, want %q", tt.lang, tt.content, got, tt.want)
+		}
+	}
+
+	// The fence must not be closed by the content it wraps.
+	b := fileBlock{Path: "README.md", Lang: "md", Content: "````go\nx\n````\n", Total: 3}
+	out := b.markdown()
+	fence := getFence(b.Lang, b.Content)
+	if !strings.HasPrefix(out, "`README.md`\n"+fence+"md\n"+b.Content+fence+"\n") {
+		t.Errorf("markdown block:\n%s", out)
+	}
+}
@@ -0,0 +1,93 @@
+package pcat
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// outlineSuffix marks a path whose outline, rather than its content, is
+// wanted, e.g. "internal/app.go@outline".
+const outlineSuffix = "@outline"
+
+var (
+	outlineDeclRe   = regexp.MustCompile(`^\s*(?:(?:export|pub|public|private|protected|internal|static|abstract|final|async|default|override|open|sealed|data)\s+)*(?:func|function|def|class|fn|struct|enum|union|interface|trait|impl|type|object|protocol)\s+\S`)
+	outlineValueRe  = regexp.MustCompile(`^(?:export\s+|pub\s+)?(?:const|let|var|val|static)\s+\S`)
+	outlineImportRe = regexp.MustCompile(`^\s*(?:import|from\s+\S+\s+import|package|use|using|require|#include|module)\b`)
+	outlineMethodRe = regexp.MustCompile(`^\s*(?:[\w<>\[\],*&:@]+\s+)*[A-Za-z_$][\w$]*\s*\([^;]*\)[^;=]*\{\s*$`)
+)
+
+// Outline reduces a source file to its shape: for Go, the package clause,
+// imports, type declarations and function signatures with their doc
+// comments; for other languages, the import, top-level value and
+// declaration lines.
+func Outline(path string, content []byte) []byte {
+	if filepath.Ext(path) == ".go" {
+		if out, ok := outlineGo(content); ok {
+			return out
+		}
+	}
+	return outlineHeuristic(content)
+}
+
+func outlineGo(content []byte) ([]byte, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return nil, false
+	}
+
+	src := func(from, to token.Pos) []byte {
+		return content[fset.Position(from).Offset:fset.Position(to).Offset]
+	}
+	withDoc := func(doc *ast.CommentGroup, node ast.Node) token.Pos {
+		if doc != nil {
+			return doc.Pos()
+		}
+		return node.Pos()
+	}
+
+	var out bytes.Buffer
+	out.WriteString("package " + file.Name.Name + "\n")
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.IMPORT && d.Tok != token.TYPE {
+				continue
+			}
+			out.WriteString("\n")
+			out.Write(src(withDoc(d.Doc, d), d.End()))
+			out.WriteString("\n")
+		case *ast.FuncDecl:
+			out.WriteString("\n")
+			end := d.End()
+			if d.Body != nil {
+				end = d.Body.Lbrace
+			}
+			out.Write(bytes.TrimRight(src(withDoc(d.Doc, d), end), " "))
+			out.WriteString("\n")
+		}
+	}
+	return out.Bytes(), true
+}
+
+func outlineHeuristic(content []byte) []byte {
+	var out bytes.Buffer
+	for line := range strings.SplitSeq(string(content), "\n") {
+		if !outlineImportRe.MatchString(line) && !outlineDeclRe.MatchString(line) &&
+			!outlineValueRe.MatchString(line) && !outlineMethodRe.MatchString(line) {
+			continue
+		}
+		if isControlStatement(line) {
+			continue
+		}
+		indent := line[:indentOf(line)]
+		text := strings.TrimSuffix(strings.TrimRight(line, " \t"), "{")
+		out.WriteString(indent + strings.TrimSpace(text) + "\n")
+	}
+	return out.Bytes()
+}
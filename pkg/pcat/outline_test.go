@@ -0,0 +1,148 @@
+package pcat
+
+import "testing"
+
+func TestOutline(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		src  string
+		want string
+	}{
+		{
+			name: "go",
+			path: "a.go",
+			src: `package a
+
+import "fmt"
+
+const limit = 3
+
+var debug bool
+
+// Server serves.
+type Server struct {
+	Addr string
+}
+
+// Run runs the server.
+func (s *Server) Run(n int) error {
+	fmt.Println(s.Addr, n)
+	return nil
+}
+
+func helper() {}
+`,
+			want: `package a
+
+import "fmt"
+
+// Server serves.
+type Server struct {
+	Addr string
+}
+
+// Run runs the server.
+func (s *Server) Run(n int) error
+
+func helper()
+`,
+		},
+		{
+			name: "invalid go falls back to the heuristic",
+			path: "b.go",
+			src: `package b
+
+func broken( {
+	x := 1
+}
+`,
+			want: "package b\nfunc broken(\n",
+		},
+		{
+			name: "javascript",
+			path: "app.js",
+			src: `import { x } from "./x";
+
+export const limit = 3;
+
+export function run(a) {
+  if (a) {
+    return x(a);
+  }
+  for (const b of a) {
+    log(b);
+  }
+}
+
+class Server {
+  start(port) {
+    listen(port);
+  }
+}
+`,
+			want: `import { x } from "./x";
+export const limit = 3;
+export function run(a)
+class Server
+  start(port)
+`,
+		},
+		{
+			name: "python",
+			path: "app.py",
+			src: `from os import path
+import sys
+
+LIMIT = 3
+
+class Server:
+    def run(self):
+        if self.ok:
+            return 1
+
+def main():
+    pass
+`,
+			want: `from os import path
+import sys
+class Server:
+    def run(self):
+def main():
+`,
+		},
+		{
+			name: "rust",
+			path: "lib.rs",
+			src: `use std::io;
+
+pub struct Server {
+    port: u16,
+}
+
+impl Server {
+    pub fn run(&self) -> io::Result<()> {
+        let x = 1;
+        Ok(())
+    }
+}
+`,
+			want: `use std::io;
+pub struct Server
+impl Server
+    pub fn run(&self) -> io::Result<()>
+`,
+		},
+	}
+	for _, tt := range tests {
+		if got := string(Outline(tt.path, []byte(tt.src))); got != tt.want {
+			t.Errorf("%s: Outline =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOutlineGoRejectsInvalidSource(t *testing.T) {
+	if _, ok := outlineGo([]byte("package b\n\nfunc broken( {\n")); ok {
+		t.Error("outlineGo accepted a file that does not parse")
+	}
+}
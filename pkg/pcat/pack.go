@@ -0,0 +1,68 @@
+package pcat
+
+import (
+	"sort"
+	"time"
+)
+
+// packBlocks keeps the blocks that fit in maxTokens and replaces the rest
+// with a one-line placeholder. Explicitly listed files are kept first, then
+// smaller files, then recently modified ones. The original order is kept.
+// count returns the token count of a rendered block.
+func packBlocks(blocks []fileBlock, explicit []string, maxTokens int, count func(fileBlock) int) []fileBlock {
+	listed := make(map[string]struct{}, len(explicit))
+	for _, f := range explicit {
+		listed[f] = struct{}{}
+	}
+
+	type candidate struct {
+		index    int
+		tokens   int
+		explicit bool
+		modTime  time.Time
+		size     int64
+	}
+	candidates := make([]candidate, len(blocks))
+	for i, b := range blocks {
+		c := candidate{index: i, tokens: count(b), modTime: b.modTime, size: b.Size}
+		_, c.explicit = listed[b.file]
+		candidates[i] = c
+	}
+
+	order := make([]candidate, len(candidates))
+	copy(order, candidates)
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if a.explicit != b.explicit {
+			return a.explicit
+		}
+		if a.tokens != b.tokens {
+			return a.tokens < b.tokens
+		}
+		return a.modTime.After(b.modTime)
+	})
+
+	// Placeholders are charged up front so that kept files cannot crowd them
+	// out of the budget.
+	placeholders := make([]fileBlock, len(blocks))
+	placeholderTokens := make([]int, len(blocks))
+	budget := maxTokens
+	for _, c := range candidates {
+		b := blocks[c.index]
+		placeholders[c.index] = fileBlock{file: b.file, Path: b.Path, Omitted: true, Size: c.size, Tokens: c.tokens}
+		placeholderTokens[c.index] = count(placeholders[c.index])
+		budget -= placeholderTokens[c.index]
+	}
+
+	packed := make([]fileBlock, len(blocks))
+	for _, c := range order {
+		extra := c.tokens - placeholderTokens[c.index]
+		if extra <= budget {
+			budget -= extra
+			packed[c.index] = blocks[c.index]
+			continue
+		}
+		packed[c.index] = placeholders[c.index]
+	}
+	return packed
+}
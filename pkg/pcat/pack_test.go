@@ -0,0 +1,108 @@
+package pcat
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackBlocks(t *testing.T) {
+	now := time.Now()
+	block := func(name string, size int, age time.Duration) fileBlock {
+		return fileBlock{file: name, Path: name, Content: strings.Repeat("x", size), Size: int64(size), modTime: now.Add(-age)}
+	}
+	// A placeholder costs one token, a file one token per byte.
+	count := func(b fileBlock) int {
+		if b.Omitted {
+			return 1
+		}
+		return len(b.Content)
+	}
+
+	tests := []struct {
+		name      string
+		blocks    []fileBlock
+		explicit  []string
+		maxTokens int
+		kept      string
+	}{
+		{
+			name:      "everything fits",
+			blocks:    []fileBlock{block("a", 10, 0), block("b", 20, 0)},
+			maxTokens: 30,
+			kept:      "a,b",
+		},
+		{
+			name:      "smaller files first",
+			blocks:    []fileBlock{block("big", 50, 0), block("s1", 10, 0), block("s2", 10, 0)},
+			maxTokens: 30,
+			kept:      "s1,s2",
+		},
+		{
+			name:      "explicit files before smaller ones",
+			blocks:    []fileBlock{block("big", 50, 0), block("s1", 10, 0), block("s2", 10, 0)},
+			explicit:  []string{"big"},
+			maxTokens: 55,
+			kept:      "big",
+		},
+		{
+			name:      "recent files break ties",
+			blocks:    []fileBlock{block("old", 10, time.Hour), block("new", 10, 0)},
+			maxTokens: 15,
+			kept:      "new",
+		},
+		{
+			name:      "nothing fits",
+			blocks:    []fileBlock{block("a", 10, 0)},
+			maxTokens: 5,
+			kept:      "",
+		},
+	}
+	for _, tt := range tests {
+		packed := packBlocks(tt.blocks, tt.explicit, tt.maxTokens, count)
+		if len(packed) != len(tt.blocks) {
+			t.Fatalf("%s: %d blocks, want %d", tt.name, len(packed), len(tt.blocks))
+		}
+
+		var kept []string
+		for i, b := range packed {
+			if b.Path != tt.blocks[i].Path {
+				t.Errorf("%s: block %d is %s, want the original order", tt.name, i, b.Path)
+			}
+			if !b.Omitted {
+				kept = append(kept, b.Path)
+				continue
+			}
+			if b.Content != "" || b.Size != tt.blocks[i].Size || b.Tokens != len(tt.blocks[i].Content) {
+				t.Errorf("%s: placeholder %+v", tt.name, b)
+			}
+		}
+		if got := strings.Join(kept, ","); got != tt.kept {
+			t.Errorf("%s: kept %q, want %q", tt.name, got, tt.kept)
+		}
+	}
+}
+
+func TestRenderedBlocksMatchOutput(t *testing.T) {
+	blocks := []fileBlock{
+		{file: "a.go", Path: "a.go", Lang: "go", Content: "package a\n\nfunc A() {}\n", Size: 24},
+		{file: "b.txt", Path: "b.txt", Omitted: true, Size: 4096, Tokens: 1000},
+		{file: "c.md", Path: "c.md", Lang: "markdown", Content: "# c\n", Size: 4},
+	}
+
+	// The budget is spent on the frame and the blocks as render returns
+	// them, so together they must add up to the printed output.
+	for _, format := range Formats {
+		out, err := renderBlocks(blocks, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := len(frame(format))
+		for _, b := range blocks {
+			sum += len(b.render(format))
+		}
+		if n := len(out); n > sum {
+			t.Errorf("%s: output is %d bytes, blocks were counted as %d", format, n, sum)
+		}
+	}
+}
@@ -1,8 +1,6 @@
 package pcat
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"io/fs"
 	"os"
@@ -14,60 +12,123 @@ import (
 	"github.com/bmatcuk/doublestar/v4"
 )
 
+// Options configures RunWithOptions. SpecificFiles may hold selectors (see
+// ParseSelector). A positive MaxTokens packs the output within that budget,
+// keeping SpecificFiles ahead of files found in directories.
+type Options struct {
+	SpecificFiles []string
+	Directories   []string
+	// ListedFiles are files already listed from directories by the caller.
+	// Like files found in Directories, they yield to SpecificFiles when
+	// packing.
+	ListedFiles     []string
+	Extensions      []string
+	ExcludePatterns []string
+	WithLineNumbers bool
+	Hidden          bool
+	ListOnly        bool
+	MaxTokens       int
+	// CountTokens counts the tokens of a text for MaxTokens and Cache; nil
+	// means EstimateTokens.
+	CountTokens func(string) int
+	// Outline renders every file as an outline (see Outline).
+	Outline bool
+	// Format is one of Formats; empty means FormatMarkdown.
+	Format string
+	// Diff is printed after the files as a separate block, e.g. the git diff
+	// of the selected files.
+	Diff string
+	// Cache, when set, reuses files and token counts from earlier runs.
+	Cache *Cache
+	// Nul ends each path of the ListOnly output with a NUL byte instead of
+	// a newline.
+	Nul bool
+}
+
 func Run(specificFiles, directories, extensions, excludePatterns []string, withLineNumbers, hidden, listOnly bool) (string, error) {
-	if len(directories) > 0 && len(extensions) == 0 {
+	return RunWithOptions(Options{
+		SpecificFiles:   specificFiles,
+		Directories:     directories,
+		Extensions:      extensions,
+		ExcludePatterns: excludePatterns,
+		WithLineNumbers: withLineNumbers,
+		Hidden:          hidden,
+		ListOnly:        listOnly,
+	})
+}
+
+func RunWithOptions(opts Options) (string, error) {
+	extensions := opts.Extensions
+	if len(opts.Directories) > 0 && len(extensions) == 0 {
 		extensions = []string{"any"}
 	}
 
-	directoryFiles, err := findDirectoryFiles(directories, extensions, hidden)
+	directoryFiles, err := findDirectoryFiles(opts.Directories, extensions, opts.Hidden)
 	if err != nil {
 		return "", fmt.Errorf("finding files: %w", err)
 	}
 
-	allFiles := deduplicate(append(directoryFiles, specificFiles...))
-	filteredFiles, err := filterExcluded(allFiles, excludePatterns)
+	allFiles := append(directoryFiles, opts.ListedFiles...)
+	allFiles = deduplicate(append(allFiles, opts.SpecificFiles...))
+	filteredFiles, err := filterExcluded(allFiles, opts.ExcludePatterns)
 	if err != nil {
 		return "", fmt.Errorf("filtering files: %w", err)
 	}
 
-	if len(filteredFiles) == 0 {
+	if len(filteredFiles) == 0 && opts.Diff == "" {
 		return "", nil
 	}
 
-	if listOnly {
-		return strings.Join(filteredFiles, "\n") + "\n", nil
+	if opts.ListOnly {
+		return JoinFileList(filteredFiles, opts.Nul), nil
 	}
 
-	return formatFiles(filteredFiles, withLineNumbers)
-}
+	format := opts.Format
+	if format == "" {
+		format = FormatMarkdown
+	}
+	if !slices.Contains(Formats, format) {
+		return "", fmt.Errorf("unknown format %q (want %s)", format, strings.Join(Formats, ", "))
+	}
 
-func formatFiles(files []string, withLineNumbers bool) (string, error) {
-	if len(files) == 0 {
-		return "", nil
+	countTokens := opts.CountTokens
+	if countTokens == nil {
+		countTokens = EstimateTokens
+	}
+	count := func(b fileBlock) int { return countTokens(b.render(format)) }
+	if cache := opts.Cache; cache != nil {
+		cache.begin()
+		count = func(b fileBlock) int { return cache.count(b, format, countTokens) }
 	}
 
-	var out strings.Builder
-	for _, file := range files {
-		content, err := os.ReadFile(file)
-		if err != nil || bytes.Contains(content, []byte{0}) {
-			continue
+	blocks := readBlocks(filteredFiles, opts.WithLineNumbers, opts.Outline, opts.Cache)
+	var diff []fileBlock
+	if opts.Diff != "" {
+		diff = []fileBlock{{Diff: true, Lang: "diff", Content: opts.Diff}}
+	}
+	if opts.MaxTokens > 0 {
+		budget := opts.MaxTokens - countTokens(frame(format))
+		if len(diff) > 0 {
+			budget -= count(diff[0])
 		}
+		blocks = packBlocks(blocks, opts.SpecificFiles, budget, count)
+	}
+	blocks = append(blocks, diff...)
 
-		out.WriteString(fmt.Sprintf("`%s`\n", file))
-		lang := getLang(file)
-		fence := getFence(lang)
-
-		out.WriteString(fmt.Sprintf("%s%s\n", fence, lang))
-		if withLineNumbers {
-			writeWithLineNumbers(&out, content)
-		} else {
-			out.Write(content)
+	if opts.Cache != nil {
+		total := 0
+		for _, b := range blocks {
+			total += count(b)
 		}
-		ensureNewline(&out, content)
-		out.WriteString(fmt.Sprintf("%s\n\n", fence))
+		opts.Cache.end(total)
 	}
-	result := strings.TrimSuffix(out.String(), "\n")
-	return result + "\n---\n", nil
+	return renderBlocks(blocks, format)
+}
+
+// EstimateTokens estimates the token count of text at about four bytes per
+// token.
+func EstimateTokens(text string) int {
+	return len(text) / 4
 }
 
 func getLang(file string) string {
@@ -78,26 +139,6 @@ func getLang(file string) string {
 	return lang
 }
 
-func getFence(lang string) string {
-	if lang == "md" || lang == "markdown" {
-		return "````"
-	}
-	return "```"
-}
-
-func writeWithLineNumbers(out *strings.Builder, content []byte) {
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	for i := 1; scanner.Scan(); i++ {
-		out.WriteString(fmt.Sprintf("%4d | %s\n", i, scanner.Text()))
-	}
-}
-
-func ensureNewline(out *strings.Builder, content []byte) {
-	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
-		out.WriteString("\n")
-	}
-}
-
 func findDirectoryFiles(directories, extensions []string, includeHidden bool) ([]string, error) {
 	fileSet := make(map[string]struct{})
 
@@ -190,7 +231,7 @@ func filterExcluded(paths []string, excludePatterns []string) ([]string, error)
 	var filtered []string
 	for _, path := range paths {
 		excluded := false
-		posixPath := filepath.ToSlash(path)
+		posixPath := filepath.ToSlash(ParseSelector(path).Path)
 		for _, pattern := range excludePatterns {
 			match, err := doublestar.Match(pattern, posixPath)
 			if err != nil {
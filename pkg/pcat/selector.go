@@ -0,0 +1,359 @@
+package pcat
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Selector picks part of a file: a line range (path:120-240), a symbol
+// (path#Name, path#Type.Method) or its outline (path@outline). A zero Start,
+// empty Symbol and unset Outline select the whole file.
+type Selector struct {
+	Path    string
+	Start   int
+	End     int
+	Symbol  string
+	Outline bool
+}
+
+var (
+	rangeSelectorRe  = regexp.MustCompile(`^(.+):(\d+)(?:-(\d*))?$`)
+	symbolSelectorRe = regexp.MustCompile(`^(.+)#([A-Za-z_$][\w$]*(?:\.[A-Za-z_$][\w$]*)?)$`)
+)
+
+// ParseSelector splits a selector into its path and selection. An argument
+// naming an existing file is always taken as a plain path.
+func ParseSelector(arg string) Selector {
+	if _, err := os.Stat(arg); err == nil {
+		return Selector{Path: arg}
+	}
+
+	if path, ok := strings.CutSuffix(arg, outlineSuffix); ok && path != "" {
+		return Selector{Path: path, Outline: true}
+	}
+	if m := symbolSelectorRe.FindStringSubmatch(arg); m != nil {
+		return Selector{Path: m[1], Symbol: m[2]}
+	}
+	if m := rangeSelectorRe.FindStringSubmatch(arg); m != nil {
+		start, _ := strconv.Atoi(m[2])
+		end := start
+		if m[3] != "" {
+			end, _ = strconv.Atoi(m[3])
+		} else if strings.HasSuffix(arg, "-") {
+			end = 0
+		}
+		if start > 0 {
+			return Selector{Path: m[1], Start: start, End: end}
+		}
+	}
+	return Selector{Path: arg}
+}
+
+func (s Selector) IsWhole() bool {
+	return s.Start == 0 && s.Symbol == "" && !s.Outline
+}
+
+func (s Selector) String() string {
+	switch {
+	case s.Outline:
+		return s.Path + outlineSuffix
+	case s.Symbol != "":
+		return s.Path + "#" + s.Symbol
+	case s.Start == 0:
+		return s.Path
+	case s.End == 0:
+		return fmt.Sprintf("%s:%d-", s.Path, s.Start)
+	default:
+		return fmt.Sprintf("%s:%d-%d", s.Path, s.Start, s.End)
+	}
+}
+
+// Lines resolves the selection against the file content and returns its
+// 1-based, inclusive line range.
+func (s Selector) Lines(content []byte) (int, int, error) {
+	total := countLines(content)
+	if s.Symbol != "" {
+		return findSymbol(s.Path, content, s.Symbol)
+	}
+	if s.Start == 0 {
+		return 1, total, nil
+	}
+
+	end := s.End
+	if end == 0 || end > total {
+		end = total
+	}
+	if s.Start > total || s.Start > end {
+		return 0, 0, fmt.Errorf("line range %d-%d is outside %s (%d lines)", s.Start, s.End, s.Path, total)
+	}
+	return s.Start, end, nil
+}
+
+func countLines(content []byte) int {
+	if len(content) == 0 {
+		return 0
+	}
+	n := bytes.Count(content, []byte("\n"))
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		n++
+	}
+	return n
+}
+
+func describeRange(start, end, total int) string {
+	if start == end {
+		return fmt.Sprintf("line %d of %d", start, total)
+	}
+	return fmt.Sprintf("lines %d-%d of %d", start, end, total)
+}
+
+// sliceLines returns lines start through end of content.
+func sliceLines(content []byte, start, end int) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return bytes.Join(lines[start-1:end], nil)
+}
+
+func findSymbol(path string, content []byte, symbol string) (int, int, error) {
+	var start, end int
+	switch filepath.Ext(path) {
+	case ".go":
+		start, end = findGoSymbol(content, symbol)
+	case ".py", ".pyi":
+		start, end = findSymbolHeuristic(content, symbol, true)
+	default:
+		start, end = findSymbolHeuristic(content, symbol, false)
+	}
+	if start == 0 {
+		return 0, 0, fmt.Errorf("symbol %s not found in %s", symbol, path)
+	}
+	return start, end, nil
+}
+
+// findGoSymbol locates a function, method (Type.Method or Method), type,
+// variable or constant, including its doc comment.
+func findGoSymbol(content []byte, symbol string) (int, int) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return findSymbolHeuristic(content, symbol, false)
+	}
+
+	recv, name, isMethod := strings.Cut(symbol, ".")
+	if !isMethod {
+		name = symbol
+	}
+
+	lines := func(doc *ast.CommentGroup, node ast.Node) (int, int) {
+		from := node.Pos()
+		if doc != nil {
+			from = doc.Pos()
+		}
+		return fset.Position(from).Line, fset.Position(node.End()).Line
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Name.Name != name {
+				continue
+			}
+			if isMethod && receiverName(d) != recv {
+				continue
+			}
+			return lines(d.Doc, d)
+		case *ast.GenDecl:
+			if isMethod {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if !specDeclares(spec, name) {
+					continue
+				}
+				if d.Lparen.IsValid() {
+					return lines(specDoc(spec), spec)
+				}
+				return lines(d.Doc, d)
+			}
+		}
+	}
+	return 0, 0
+}
+
+func receiverName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return ""
+	}
+	expr := d.Recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+func specDeclares(spec ast.Spec, name string) bool {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Name.Name == name
+	case *ast.ValueSpec:
+		for _, n := range s.Names {
+			if n.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+const symbolKeywords = `func|function|def|class|fn|struct|enum|union|interface|trait|impl|type|module|object|protocol|const|let|var|val`
+
+// findSymbolHeuristic finds a declaration by keyword or by a call-like
+// signature, then ends it where its braces balance or, for indented blocks,
+// where the indentation returns to the declaration's level. A Type.Method
+// symbol is only looked for inside the blocks that declare Type, such as its
+// class or impl block.
+func findSymbolHeuristic(content []byte, symbol string, indented bool) (int, int) {
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	typeName, name, qualified := strings.Cut(symbol, ".")
+	if !qualified {
+		return findDeclaration(lines, 0, len(lines), symbol, indented)
+	}
+
+	typeRe := declarationPatterns(typeName)[0]
+	for i, line := range lines {
+		if !typeRe.MatchString(line) || isControlStatement(line) {
+			continue
+		}
+		end := blockEnd(lines, i, indented)
+		if start, end := findDeclaration(lines, i+1, end+1, name, indented); start != 0 {
+			return start, end
+		}
+	}
+	return 0, 0
+}
+
+// declarationPatterns match a declaration of name by keyword, or failing
+// that by a call-like signature.
+func declarationPatterns(name string) []*regexp.Regexp {
+	name = regexp.QuoteMeta(name)
+	return []*regexp.Regexp{
+		regexp.MustCompile(`^\s*(?:[\w@]+\s+)*(?:` + symbolKeywords + `)\s*\*?\s*` + name + `\b`),
+		regexp.MustCompile(`^\s*(?:[\w<>\[\],*&:]+\s+)*` + name + `\s*\(`),
+	}
+}
+
+// findDeclaration looks for name in lines[from:to] and returns its 1-based
+// line range, including leading comments.
+func findDeclaration(lines []string, from, to int, name string, indented bool) (int, int) {
+	for _, re := range declarationPatterns(name) {
+		for i := from; i < to; i++ {
+			if !re.MatchString(lines[i]) || isControlStatement(lines[i]) {
+				continue
+			}
+			start := i
+			for start > from && isLeadingComment(lines[start-1]) {
+				start--
+			}
+			return start + 1, blockEnd(lines, i, indented) + 1
+		}
+	}
+	return 0, 0
+}
+
+func isControlStatement(line string) bool {
+	word := strings.Fields(line)[0]
+	switch word {
+	case "if", "for", "while", "switch", "return", "else", "catch":
+		return true
+	}
+	return false
+}
+
+func isLeadingComment(line string) bool {
+	t := strings.TrimSpace(line)
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", "@"} {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func blockEnd(lines []string, start int, indented bool) int {
+	if indented || strings.HasSuffix(strings.TrimSpace(lines[start]), ":") {
+		return indentedBlockEnd(lines, start)
+	}
+
+	depth := 0
+	opened := false
+	for i := start; i < len(lines); i++ {
+		for _, r := range lines[i] {
+			switch r {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		if opened && depth <= 0 {
+			return i
+		}
+		if !opened && strings.HasSuffix(strings.TrimSpace(lines[i]), ";") {
+			return i
+		}
+	}
+	if !opened {
+		return start
+	}
+	return len(lines) - 1
+}
+
+func indentedBlockEnd(lines []string, start int) int {
+	base := indentOf(lines[start])
+	end := start
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if indentOf(lines[i]) <= base {
+			break
+		}
+		end = i
+	}
+	return end
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
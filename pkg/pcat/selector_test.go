@@ -0,0 +1,144 @@
+package pcat
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("odd:12", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg  string
+		want Selector
+		// str is the String form when it differs from arg.
+		str string
+	}{
+		{"a.go", Selector{Path: "a.go"}, ""},
+		{"a.go:10-20", Selector{Path: "a.go", Start: 10, End: 20}, ""},
+		{"a.go:10-", Selector{Path: "a.go", Start: 10}, ""},
+		{"a.go:7", Selector{Path: "a.go", Start: 7, End: 7}, "a.go:7-7"},
+		{"a.go:0", Selector{Path: "a.go:0"}, ""},
+		{"a.go#Run", Selector{Path: "a.go", Symbol: "Run"}, ""},
+		{"a.go#Server.Run", Selector{Path: "a.go", Symbol: "Server.Run"}, ""},
+		{"a.go#a.b.c", Selector{Path: "a.go#a.b.c"}, ""},
+		{"a.go@outline", Selector{Path: "a.go", Outline: true}, ""},
+		{"odd:12", Selector{Path: "odd:12"}, ""},
+	}
+	for _, tt := range tests {
+		got := ParseSelector(tt.arg)
+		if got != tt.want {
+			t.Errorf("ParseSelector(%q) = %+v, want %+v", tt.arg, got, tt.want)
+		}
+		str := tt.str
+		if str == "" {
+			str = tt.arg
+		}
+		if got.String() != str {
+			t.Errorf("ParseSelector(%q).String() = %q, want %q", tt.arg, got.String(), str)
+		}
+	}
+}
+
+const goSource = `package p
+
+// Server serves.
+type Server struct{}
+
+// Run runs the server.
+func (s *Server) Run() {
+	s.stop()
+}
+
+func Run() {}
+
+const (
+	A = 1
+	// B is two.
+	B = 2
+)
+
+var x = 3
+`
+
+const jsSource = `class A {
+  run() {
+    return 1;
+  }
+}
+
+class B {
+  // run runs B.
+  run() {
+    return 2;
+  }
+}
+
+function helper(x) {
+  return x;
+}
+`
+
+const pySource = `class Server:
+    def start(self):
+        pass
+
+    def stop(self):
+        pass
+
+
+def stop():
+    pass
+`
+
+const rustSource = `struct Server {
+    port: u16,
+}
+
+impl Server {
+    fn run(&self) {
+        listen();
+    }
+}
+`
+
+func TestSelectorLines(t *testing.T) {
+	tests := []struct {
+		sel        string
+		content    string
+		start, end int
+		wantErr    bool
+	}{
+		{"a.go", goSource, 1, 19, false},
+		{"a.go:4-6", goSource, 4, 6, false},
+		{"a.go:18-", goSource, 18, 19, false},
+		{"a.go:30", goSource, 0, 0, true},
+		{"a.go#Server", goSource, 3, 4, false},
+		{"a.go#Server.Run", goSource, 6, 9, false},
+		{"a.go#Run", goSource, 6, 9, false},
+		{"a.go#Other.Run", goSource, 0, 0, true},
+		{"a.go#B", goSource, 15, 16, false},
+		{"a.go#x", goSource, 19, 19, false},
+		{"a.js#helper", jsSource, 14, 16, false},
+		{"a.js#B.run", jsSource, 8, 11, false},
+		{"a.js#A.run", jsSource, 2, 4, false},
+		{"a.js#C.run", jsSource, 0, 0, true},
+		{"a.py#Server.stop", pySource, 5, 6, false},
+		{"a.py#stop", pySource, 5, 6, false},
+		{"a.py#Other.stop", pySource, 0, 0, true},
+		{"a.rs#Server.run", rustSource, 6, 8, false},
+	}
+	for _, tt := range tests {
+		start, end, err := ParseSelector(tt.sel).Lines([]byte(tt.content))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.sel, err, tt.wantErr)
+			continue
+		}
+		if start != tt.start || end != tt.end {
+			t.Errorf("%s: lines %d-%d, want %d-%d", tt.sel, start, end, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package sf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GitSelection selects files by their git status: tracked files that differ
+// from HEAD (Changed), files with staged changes (Staged), untracked files
+// that are not ignored (Untracked) and files changed since the merge base
+// of Since and HEAD, including uncommitted changes.
+type GitSelection struct {
+	Changed   bool
+	Staged    bool
+	Untracked bool
+	Since     string
+}
+
+func (g GitSelection) IsZero() bool {
+	return !g.Changed && !g.Staged && !g.Untracked && g.Since == ""
+}
+
+// GitFiles returns the existing files under roots selected by sel, relative
+// to the working directory and sorted. Deleted files are left out.
+func GitFiles(roots []string, sel GitSelection, excludes []string, showHidden bool) ([]string, error) {
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	var lists [][]string
+	add := func(args ...string) error {
+		args = append(append(args, "--"), roots...)
+		files, err := gitPaths(args...)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, files)
+		return nil
+	}
+
+	if sel.Changed {
+		if err := add("diff", "--name-only", "-z", "--relative"); err != nil {
+			return nil, err
+		}
+	}
+	if sel.Changed || sel.Staged {
+		if err := add("diff", "--name-only", "-z", "--relative", "--cached"); err != nil {
+			return nil, err
+		}
+	}
+	if sel.Untracked {
+		if err := add("ls-files", "--others", "--exclude-standard", "-z"); err != nil {
+			return nil, err
+		}
+	}
+	if sel.Since != "" {
+		base, err := mergeBase(sel.Since)
+		if err != nil {
+			return nil, err
+		}
+		if err := add("diff", "--name-only", "-z", "--relative", base); err != nil {
+			return nil, err
+		}
+	}
+
+	matcher := NewMatcher(".", excludes, showHidden)
+	seen := make(map[string]struct{})
+	var files []string
+	for _, list := range lists {
+		for _, f := range list {
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = struct{}{}
+
+			if info, err := os.Stat(f); err != nil || info.IsDir() {
+				continue
+			}
+			if !showHidden && hasHiddenSegment(f) {
+				continue
+			}
+			if matcher.matchExcludes(f, filepath.Base(f)) {
+				continue
+			}
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// GitDiff returns the diff of paths for sel: against HEAD for Changed, the
+// index for Staged and the merge base for Since. Untracked files have no
+// diff; their content is the change.
+func GitDiff(sel GitSelection, paths []string) (string, error) {
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	args := []string{"diff", "--relative"}
+	switch {
+	case sel.Since != "":
+		base, err := mergeBase(sel.Since)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, base)
+	case sel.Changed:
+		args = append(args, "HEAD")
+	case sel.Staged:
+		args = append(args, "--cached")
+	default:
+		return "", nil
+	}
+	args = append(args, "--")
+	args = append(args, paths...)
+
+	out, err := git(args...)
+	return string(out), err
+}
+
+func mergeBase(ref string) (string, error) {
+	out, err := git("merge-base", ref, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gitPaths(args ...string) ([]string, error) {
+	out, err := git(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for p := range strings.SplitSeq(string(out), "\x00") {
+		if p != "" {
+			paths = append(paths, filepath.FromSlash(p))
+		}
+	}
+	return paths, nil
+}
+
+func git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func hasHiddenSegment(path string) bool {
+	for part := range strings.SplitSeq(filepath.ToSlash(path), "/") {
+		if len(part) > 1 && strings.HasPrefix(part, ".") && part != ".." {
+			return true
+		}
+	}
+	return false
+}
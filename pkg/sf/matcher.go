@@ -57,20 +57,19 @@ func (m *Matcher) ShouldSkip(path string, info os.DirEntry) bool {
 		}
 	}
 
-	if m.matchExcludes(path, info) {
+	if m.matchExcludes(path, info.Name()) {
 		return true
 	}
 
 	return false
 }
 
-func (m *Matcher) matchExcludes(path string, info os.DirEntry) bool {
+func (m *Matcher) matchExcludes(path, name string) bool {
 	if len(m.excludes) == 0 {
 		return false
 	}
 
 	rel := m.getRelativePath(path)
-	name := info.Name()
 
 	for _, pattern := range m.excludes {
 		pattern = filepath.ToSlash(pattern)
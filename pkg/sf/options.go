@@ -0,0 +1,145 @@
+package sf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures RunWithOptions. Zero values disable a filter.
+type Options struct {
+	// Type is "file", "dir" or empty for both.
+	Type     string
+	Excludes []string
+	Hidden   bool
+	// Extensions keeps files with one of these extensions, with or without
+	// the leading dot.
+	Extensions []string
+	// Glob and Pattern match the base name.
+	Glob    string
+	Pattern *regexp.Regexp
+	// MinSize and MaxSize bound the size of files in bytes.
+	MinSize int64
+	MaxSize int64
+	// ChangedWithin keeps entries modified less than this long ago and
+	// ChangedBefore those modified longer ago.
+	ChangedWithin time.Duration
+	ChangedBefore time.Duration
+	// MaxDepth limits the walk to this many levels below each root; 1 lists
+	// only the entries of the roots.
+	MaxDepth int
+	// FollowSymlinks walks symlinked directories. A link back to a directory
+	// being walked is listed but not followed.
+	FollowSymlinks bool
+}
+
+// Match reports whether the entry at path passes the extension, name, size
+// and time filters. Type and depth are checked by the walk.
+func (o Options) Match(path string, info os.FileInfo) bool {
+	return o.match(path, info.IsDir(), func() (os.FileInfo, error) { return info, nil })
+}
+
+// match only calls info when a filter needs it, so the walk does not stat
+// every entry.
+func (o Options) match(path string, isDir bool, info func() (os.FileInfo, error)) bool {
+	if len(o.Extensions) > 0 && (isDir || !o.hasExtension(path)) {
+		return false
+	}
+
+	name := filepath.Base(path)
+	if o.Glob != "" {
+		if ok, _ := filepath.Match(o.Glob, name); !ok {
+			return false
+		}
+	}
+	if o.Pattern != nil && !o.Pattern.MatchString(name) {
+		return false
+	}
+
+	sized := o.MinSize > 0 || o.MaxSize > 0
+	if !sized && o.ChangedWithin == 0 && o.ChangedBefore == 0 {
+		return true
+	}
+	fi, err := info()
+	if err != nil {
+		return false
+	}
+	if sized && (isDir || fi.Size() < o.MinSize || (o.MaxSize > 0 && fi.Size() > o.MaxSize)) {
+		return false
+	}
+	age := time.Since(fi.ModTime())
+	if o.ChangedWithin > 0 && age > o.ChangedWithin {
+		return false
+	}
+	if o.ChangedBefore > 0 && age < o.ChangedBefore {
+		return false
+	}
+	return true
+}
+
+func (o Options) hasExtension(path string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	for _, e := range o.Extensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSize parses a size such as "512", "10k", "1.5M" or "2G", in bytes with
+// binary multiples.
+func ParseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "b")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(num, "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(num, "m"):
+		mult = 1 << 20
+	case strings.HasSuffix(num, "g"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		num = num[:len(num)-1]
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512, 10k, 1M)", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// FormatSize formats a size in bytes for people, e.g. "1.5 MiB".
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// ParseAge parses a duration as time.ParseDuration does, also accepting
+// whole days and weeks such as "1d" or "2w".
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if num, ok := strings.CutSuffix(s, suffix); ok {
+			if n, err := strconv.Atoi(num); err == nil && n >= 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q (want e.g. 30m, 12h, 1d, 2w)", s)
+	}
+	return d, nil
+}
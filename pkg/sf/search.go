@@ -0,0 +1,188 @@
+package sf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// binarySniffLen is how much of a file is checked for a NUL byte to decide
+// that it is binary and skip it.
+const binarySniffLen = 8000
+
+// SearchOptions configures a content search. Pattern is a regular expression
+// unless Literal is set. With SmartCase, a pattern without upper case letters
+// ignores case.
+type SearchOptions struct {
+	Pattern    string
+	Literal    bool
+	IgnoreCase bool
+	SmartCase  bool
+	// Context is the number of lines kept before and after each match.
+	Context int
+	// MaxMatches stops searching a file after this many matching lines.
+	MaxMatches int
+}
+
+// Match is a matching line. Line and Column are 1-based; Column is the byte
+// offset of the first match in the line. Before and After hold the context
+// lines that are not already part of a neighbouring match.
+type Match struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// Compile returns the regular expression for the search.
+func (o SearchOptions) Compile() (*regexp.Regexp, error) {
+	pattern := o.Pattern
+	if o.Literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if o.IgnoreCase || (o.SmartCase && !hasUpper(o.Pattern)) {
+		pattern = "(?i)" + pattern
+	}
+	// Multi-line mode lets ^ and $ match at line boundaries when a whole
+	// file is checked for a match before it is split into lines.
+	pattern = "(?m)" + pattern
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+	return re, nil
+}
+
+func hasUpper(s string) bool {
+	return strings.IndexFunc(s, unicode.IsUpper) >= 0
+}
+
+// Search walks roots like RunWithOptions and returns the matching lines of
+// the files it finds, sorted by path and line. Binary files are skipped.
+func Search(roots []string, opts Options, search SearchOptions) ([]Match, error) {
+	re, err := search.Compile()
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	opts.Type = "file"
+	engine := NewEngineWithOptions(runtime.NumCPU()*2, opts)
+	resultsChan := make(chan []Match, 100)
+
+	go engine.Search(roots, re, search, resultsChan)
+
+	var files [][]Match
+	for matches := range resultsChan {
+		files = append(files, matches)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i][0].Path < files[j][0].Path })
+
+	var matches []Match
+	for _, f := range files {
+		matches = append(matches, f...)
+	}
+	return matches, nil
+}
+
+// Search walks roots and sends the matches of each file that has any, in
+// line order, to results, which it closes when done. The files are searched
+// by as many workers as the engine walks directories with.
+func (e *Engine) Search(roots []string, re *regexp.Regexp, opts SearchOptions, results chan<- []Match) {
+	paths := make(chan string, 100)
+	go e.Walk(roots, paths)
+
+	var wg sync.WaitGroup
+	for range cap(e.concurrency) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if matches := searchFile(path, re, opts); len(matches) > 0 {
+					results <- matches
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(results)
+}
+
+func searchFile(path string, re *regexp.Regexp, opts SearchOptions) []Match {
+	content, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+		return nil
+	}
+	if bytes.IndexByte(content, '\r') < 0 && !re.Match(content) {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	var matched []int
+	var columns []int
+	for i, line := range lines {
+		if loc := re.FindStringIndex(line); loc != nil {
+			matched = append(matched, i)
+			columns = append(columns, loc[0]+1)
+			if opts.MaxMatches > 0 && len(matched) == opts.MaxMatches {
+				break
+			}
+		}
+	}
+
+	matches := make([]Match, len(matched))
+	for k, i := range matched {
+		m := Match{Path: path, Line: i + 1, Column: columns[k], Text: lines[i]}
+		if opts.Context > 0 {
+			// Lines between two matches go to the After of the first and
+			// then the Before of the second, so none is repeated.
+			from := max(i-opts.Context, 0)
+			if k > 0 {
+				from = max(from, matched[k-1]+opts.Context+1, matched[k-1]+1)
+			}
+			to := min(i+opts.Context, len(lines)-1)
+			if k+1 < len(matched) {
+				to = min(to, matched[k+1]-1)
+			}
+			if from < i {
+				m.Before = lines[from:i]
+			}
+			if to > i {
+				m.After = lines[i+1 : to+1]
+			}
+		}
+		matches[k] = m
+	}
+	return matches
+}
+
+// Regions returns the line ranges of the matches with their context by path,
+// merging ranges that overlap or touch. Matches must be sorted by line.
+func Regions(matches []Match) map[string][][2]int {
+	regions := make(map[string][][2]int)
+	for _, m := range matches {
+		r := [2]int{m.Line - len(m.Before), m.Line + len(m.After)}
+		list := regions[m.Path]
+		if n := len(list); n > 0 && r[0] <= list[n-1][1]+1 {
+			list[n-1][1] = max(list[n-1][1], r[1])
+			continue
+		}
+		regions[m.Path] = append(list, r)
+	}
+	return regions
+}
@@ -6,11 +6,15 @@ import (
 )
 
 func Run(roots []string, fileType string, excludes []string, showHidden bool) []string {
+	return RunWithOptions(roots, Options{Type: fileType, Excludes: excludes, Hidden: showHidden})
+}
+
+func RunWithOptions(roots []string, opts Options) []string {
 	if len(roots) == 0 {
 		roots = []string{"."}
 	}
 
-	engine := NewEngine(runtime.NumCPU()*2, fileType, excludes, showHidden)
+	engine := NewEngineWithOptions(runtime.NumCPU()*2, opts)
 	resultsChan := make(chan string, 100)
 
 	go engine.Walk(roots, resultsChan)
@@ -3,7 +3,12 @@ package sf_test
 import (
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/sokinpui/coder/pkg/sf"
 )
@@ -28,3 +33,94 @@ func TestRun(t *testing.T) {
 
 	t.Logf("Found %d entries", len(results))
 }
+
+func TestRunWithOptions(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, size int) {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", 10)
+	write("big.txt", 4096)
+	write("sub/b.go", 10)
+	write("sub/deep/c.go", 10)
+	if err := os.Symlink("..", filepath.Join(root, "sub", "up")); err != nil {
+		t.Fatal(err)
+	}
+
+	rel := func(paths []string) []string {
+		for i, p := range paths {
+			paths[i], _ = filepath.Rel(root, p)
+			paths[i] = filepath.ToSlash(paths[i])
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name string
+		opts sf.Options
+		want []string
+	}{
+		{"extension", sf.Options{Extensions: []string{"go"}}, []string{"a.go", "sub/b.go", "sub/deep/c.go"}},
+		{"max depth", sf.Options{Type: "file", MaxDepth: 2}, []string{"a.go", "big.txt", "sub/b.go", "sub/up"}},
+		{"min size", sf.Options{MinSize: 1024}, []string{"big.txt"}},
+		{"regex", sf.Options{Pattern: regexp.MustCompile(`^[bc]\.`)}, []string{"sub/b.go", "sub/deep/c.go"}},
+		{"follow stops at loops", sf.Options{Extensions: []string{"go"}, FollowSymlinks: true}, []string{"a.go", "sub/b.go", "sub/deep/c.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rel(sf.RunWithOptions([]string{root}, tt.opts))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{"1d": 24 * time.Hour, "2w": 14 * 24 * time.Hour, "90m": 90 * time.Minute} {
+		if got, err := sf.ParseAge(in); err != nil || got != want {
+			t.Errorf("ParseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	root := t.TempDir()
+	content := "one\nfoo two\nthree\nfour\nFoo five\nsix\n"
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "b.bin"), []byte("foo\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := sf.Search([]string{root}, sf.Options{}, sf.SearchOptions{Pattern: "foo", SmartCase: true, Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %v", len(matches), matches)
+	}
+	first, second := matches[0], matches[1]
+	if first.Line != 2 || first.Column != 1 || !slices.Equal(first.Before, []string{"one"}) || !slices.Equal(first.After, []string{"three"}) {
+		t.Errorf("first match = %+v", first)
+	}
+	if second.Line != 5 || !slices.Equal(second.Before, []string{"four"}) || !slices.Equal(second.After, []string{"six"}) {
+		t.Errorf("second match = %+v", second)
+	}
+
+	regions := sf.Regions(matches)[first.Path]
+	if want := [][2]int{{1, 6}}; !slices.Equal(regions, want) {
+		t.Errorf("regions = %v, want %v", regions, want)
+	}
+
+	if _, err := sf.Search([]string{root}, sf.Options{}, sf.SearchOptions{Pattern: "("}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
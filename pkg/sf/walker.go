@@ -3,42 +3,47 @@ package sf
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 )
 
 type Engine struct {
 	concurrency chan struct{}
 	wg          sync.WaitGroup
-	fileType    string
-	excludes    []string
-	showHidden  bool
+	opts        Options
 }
 
 func NewEngine(maxConcurrency int, fileType string, excludes []string, showHidden bool) *Engine {
+	return NewEngineWithOptions(maxConcurrency, Options{Type: fileType, Excludes: excludes, Hidden: showHidden})
+}
+
+func NewEngineWithOptions(maxConcurrency int, opts Options) *Engine {
 	return &Engine{
 		concurrency: make(chan struct{}, maxConcurrency),
-		fileType:    fileType,
-		excludes:    excludes,
-		showHidden:  showHidden,
+		opts:        opts,
 	}
 }
 
 func (e *Engine) Walk(roots []string, results chan<- string) {
 	for _, root := range roots {
-		matcher := NewMatcher(root, e.excludes, e.showHidden)
+		matcher := NewMatcher(root, e.opts.Excludes, e.opts.Hidden)
 		e.wg.Add(1)
 
 		go func(r string, m *Matcher) {
 			defer e.wg.Done()
 
-			info, err := os.Lstat(r)
+			stat := os.Lstat
+			if e.opts.FollowSymlinks {
+				stat = os.Stat
+			}
+			info, err := stat(r)
 			if err != nil {
 				return
 			}
 
 			if info.IsDir() {
-				e.spawnWorker(r, results, m)
-			} else if e.isTypeMatch(info.IsDir()) {
+				e.spawnWorker(r, 1, nil, results, m)
+			} else if e.isTypeMatch(info.IsDir()) && e.opts.Match(r, info) {
 				results <- r
 			}
 		}(root, matcher)
@@ -50,7 +55,10 @@ func (e *Engine) Walk(roots []string, results chan<- string) {
 	}()
 }
 
-func (e *Engine) walkDir(path string, results chan<- string, matcher *Matcher) {
+// walkDir lists the entries of path, which are depth levels below the root.
+// ancestors holds the resolved paths of the directories being walked, to
+// detect symlink loops.
+func (e *Engine) walkDir(path string, depth int, ancestors []string, results chan<- string, matcher *Matcher) {
 	defer e.wg.Done()
 
 	entries, err := os.ReadDir(path)
@@ -58,6 +66,12 @@ func (e *Engine) walkDir(path string, results chan<- string, matcher *Matcher) {
 		return
 	}
 
+	if e.opts.FollowSymlinks {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			ancestors = append(ancestors[:len(ancestors):len(ancestors)], real)
+		}
+	}
+
 	for _, entry := range entries {
 		fullPath := filepath.Join(path, entry.Name())
 
@@ -65,35 +79,47 @@ func (e *Engine) walkDir(path string, results chan<- string, matcher *Matcher) {
 			continue
 		}
 
-		if e.isTypeMatch(entry.IsDir()) {
+		isDir := entry.IsDir()
+		info := entry.Info
+		descend := isDir
+		if e.opts.FollowSymlinks && entry.Type()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(fullPath); err == nil {
+				isDir = target.IsDir()
+				info = func() (os.FileInfo, error) { return target, nil }
+				real, err := filepath.EvalSymlinks(fullPath)
+				descend = isDir && err == nil && !slices.Contains(ancestors, real)
+			}
+		}
+
+		if e.isTypeMatch(isDir) && e.opts.match(fullPath, isDir, info) {
 			results <- fullPath
 		}
 
-		if entry.IsDir() {
-			e.spawnWorker(fullPath, results, matcher)
+		if descend && (e.opts.MaxDepth == 0 || depth < e.opts.MaxDepth) {
+			e.spawnWorker(fullPath, depth+1, ancestors, results, matcher)
 		}
 	}
 }
 
-func (e *Engine) spawnWorker(path string, results chan<- string, matcher *Matcher) {
+func (e *Engine) spawnWorker(path string, depth int, ancestors []string, results chan<- string, matcher *Matcher) {
 	e.wg.Add(1)
 	select {
 	case e.concurrency <- struct{}{}:
 		go func() {
-			e.walkDir(path, results, matcher)
+			e.walkDir(path, depth, ancestors, results, matcher)
 			<-e.concurrency
 		}()
 	default:
-		e.walkDir(path, results, matcher)
+		e.walkDir(path, depth, ancestors, results, matcher)
 	}
 }
 
 func (e *Engine) isTypeMatch(isDir bool) bool {
-	if e.fileType == "" {
+	if e.opts.Type == "" {
 		return true
 	}
 
-	switch e.fileType {
+	switch e.opts.Type {
 	case "file":
 		return !isDir
 	case "dir":